@@ -1,16 +1,19 @@
 module github.com/chettriyuvraj/ez-ssg/v2
 
-
 go 1.23.1
 
-require github.com/gomarkdown/markdown v0.0.0-20240930133441-72d49d9543d8
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/gomarkdown/markdown v0.0.0-20240930133441-72d49d9543d8
+	github.com/jroimartin/gocui v0.5.0
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/image v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/jroimartin/gocui v0.5.0 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/nsf/termbox-go v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,33 +1,68 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
 	"io"
 	"io/fs"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	osexec "os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
 	"github.com/jroimartin/gocui"
+	"golang.org/x/image/draw"
+	"gopkg.in/yaml.v3"
 )
 
 type Paths struct {
-	Blog string `json:"blog"`
+	Blog   string `json:"blog"`
+	Assets string `json:"assets,omitempty"` /* Path the assets are copied to and linked from e.g. "/static", "/assets" by default */
+}
+
+/* Content rendered like posts, but from its own folder to its own path e.g. projects */
+type Section struct {
+	Dir    string `json:"dir"`              /* Folder in 'markdown' the section's pages are read from e.g. "projects" */
+	Layout string `json:"layout,omitempty"` /* Layout of the section's pages, "post" by default */
+	Path   string `json:"path"`             /* Path the section is served at e.g. "/projects" - its pages are under it */
+	Title  string `json:"title,omitempty"`  /* Title of the section's listing page, the folder name by default */
+	Pages  []Post `json:"-"`                /* Parsed pages of the section, set during generate */
 }
 
 type GoogleAnalytics struct {
@@ -36,57 +71,404 @@ type GoogleAnalytics struct {
 type Link struct {
 	URL         string `json:"URL"`
 	DisplayText string `json:"display_text"`
+	Icon        string `json:"icon,omitempty"`    /* Name of an icon shown before the text, e.g. "github" */
+	NewTab      bool   `json:"new_tab,omitempty"` /* Open the link in a new tab */
+	Rel         string `json:"rel,omitempty"`     /* rel attribute of the link e.g. "me", "noopener noreferrer" for links opening in a new tab if empty */
+}
+
+/* rel attribute of a special link, empty if it has none */
+func (l Link) RelAttr() string {
+	if l.Rel == "" && l.NewTab {
+		return "noopener noreferrer"
+	}
+	return l.Rel
+}
+
+type NavItem struct {
+	Text   string `json:"text"`
+	URL    string `json:"url"`              /* Paths starting with '/' are relative to the site URL */
+	Weight int    `json:"weight,omitempty"` /* Items with a lower weight are displayed first */
+}
+
+type CodeBlocks struct {
+	CopyButton  bool `json:"copy_button"`  /* Adds a copy-to-clipboard button to every code block */
+	LineNumbers bool `json:"line_numbers"` /* Numbers every line of a code block */
+}
+
+/* Shell commands run by generate e.g. to compile CSS into markdown/assets before the site is generated, none by default */
+type Hooks struct {
+	PreBuild  string `json:"pre_build,omitempty"`  /* Run before generating e.g. "npm run css" */
+	PostBuild string `json:"post_build,omitempty"` /* Run once the site is generated e.g. to optimize its images */
+}
+
+/* File written as it is into the site e.g. _redirects for Netlify, either Content or Source is set */
+type ExtraFile struct {
+	Path    string `json:"path"`              /* Relative to the site directory e.g. "_redirects" or ".well-known/security.txt" */
+	Content string `json:"content,omitempty"` /* Content of the file */
+	Source  string `json:"source,omitempty"`  /* File in markdown to copy instead e.g. "hosting/_headers" */
+}
+
+/* Notice shown at the top of every page until the reader dismisses it */
+type Announcement struct {
+	Text string `json:"text"`
+	URL  string `json:"url,omitempty"` /* Makes the text a link */
+}
+
+type Comments struct {
+	Provider   string `json:"provider"`              /* One of "giscus", "utterances" or "disqus" */
+	Repo       string `json:"repo,omitempty"`        /* giscus + utterances e.g. "chettriyuvraj/blog-comments" */
+	RepoID     string `json:"repo_id,omitempty"`     /* giscus */
+	Category   string `json:"category,omitempty"`    /* giscus */
+	CategoryID string `json:"category_id,omitempty"` /* giscus */
+	IssueTerm  string `json:"issue_term,omitempty"`  /* utterances, "pathname" by default */
+	Theme      string `json:"theme,omitempty"`       /* giscus + utterances */
+	Shortname  string `json:"shortname,omitempty"`   /* disqus */
 }
 type Tag struct {
-	Slug   string `json:"slug"`
-	Layout string `json:"layout,omitempty"`
+	Slug        string   `json:"slug"`
+	Name        string   `json:"name,omitempty"`        /* Displayed instead of the slug e.g. "Go Programming" for "golang" */
+	Description string   `json:"description,omitempty"` /* Shown on the tag's page */
+	Category    string   `json:"category,omitempty"`    /* Groups tags on the blog page e.g. "Languages" */
+	Posts       []string `json:"posts,omitempty"`       /* Posts (by file name without .md) listed first on the tag's page in this order e.g. a reading list */
+	Layout      string   `json:"layout,omitempty"`
+	Permalink   string   `json:"-"` /* Absolute URL of the tag's page, set during generate */
+	Count       int      `json:"-"` /* Number of published posts with the tag, set during generate e.g. for a tag cloud */
+}
+
+type TagGroup struct {
+	Category string /* Empty for uncategorized tags */
+	Tags     []Tag
+}
+
+type PostGroup struct {
+	Year  int /* Zero for posts without a date, and when posts aren't grouped */
+	Posts []Post
 }
 
 type Config struct {
-	Title        string          `json:"title"`
-	Description  string          `json:"description"`
-	URL          string          `json:"URL"`
-	SpecialLinks []Link          `json:"special_links"`
-	Paths        Paths           `json:"paths"`
-	Analytics    GoogleAnalytics `json:"google_analytics"`
-	Tags         []Tag           `json:"tags,omitempty"`
-	Posts        []Post          `json:"posts,omitempty"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description"`
+	URL            string          `json:"URL"`
+	Language       string          `json:"language"`            /* BCP-47 language tag of the content e.g. "en" or "pt-BR", "en" by default */
+	TextDirection  string          `json:"text_direction"`      /* "ltr", "rtl" or "auto", "ltr" by default */
+	Languages      []string        `json:"languages,omitempty"` /* Other languages posts are translated into e.g. ["fr", "de"] */
+	SpecialLinks   []Link          `json:"special_links"`
+	Nav            []NavItem       `json:"nav,omitempty"`
+	Paths          Paths           `json:"paths"`
+	Sections       []Section       `json:"sections,omitempty"` /* Content besides posts e.g. [{"dir": "projects", "layout": "project", "path": "/projects"}] */
+	Analytics      GoogleAnalytics `json:"google_analytics"`
+	Comments       *Comments       `json:"comments,omitempty"`
+	Announcement   *Announcement   `json:"announcement,omitempty"`
+	CodeBlocks     CodeBlocks      `json:"code_blocks"`
+	Math           bool            `json:"math"`                          /* Render $...$, $$...$$ and fenced 'math' blocks using KaTeX */
+	NotFoundHints  bool            `json:"not_found_suggestions"`         /* Suggest pages similar to the missing one on the 404 page, embedding the titles and URLs of all pages */
+	CopyrightSince int             `json:"copyright_since,omitempty"`     /* First year of the copyright notice in the footer */
+	Favicon        string          `json:"favicon,omitempty"`             /* Image in markdown/assets to generate favicons in all sizes from e.g. "images/logo.png" */
+	KeepFiles      []string        `json:"keep_files,omitempty"`          /* Patterns of files in the site directory never pruned e.g. "CNAME" */
+	DateFormat     string          `json:"date_format,omitempty"`         /* How dates are displayed - "iso", "long", "us" or a Go layout, as stored if empty */
+	ExcerptSep     string          `json:"excerpt_separator,omitempty"`   /* Ends the summary of a post shown on the blog page, "<!--more-->" by default */
+	ReadMoreText   string          `json:"read_more_text,omitempty"`      /* Text of the link to a post after its summary, "Read more" by default */
+	Extensionless  bool            `json:"extensionless_pages"`           /* Write posts and tag pages without the .html extension */
+	ExternalNewTab bool            `json:"external_links_new_tab"`        /* Open links to other sites in a new tab, links within the site always open in the same tab */
+	FeedFull       bool            `json:"feed_full_content"`             /* Feed items carry the whole post instead of its summary */
+	PostExtensions []string        `json:"post_extensions,omitempty"`     /* File extensions of posts and pages, ["md", "markdown"] by default */
+	PostsPerPage   int             `json:"posts_per_page,omitempty"`      /* Splits tag pages listing more posts into several pages, all on one page if 0 */
+	GroupByYear    bool            `json:"group_posts_by_year"`           /* List posts on the blog page under a heading for each year, newest first */
+	EmbeddedAssets *bool           `json:"use_embedded_assets,omitempty"` /* Set to false to only copy markdown/assets, without the default style.css and favicon.ico */
+	NoJekyll       *bool           `json:"nojekyll,omitempty"`            /* Set to false to leave out the .nojekyll file which stops GitHub Pages from running Jekyll on the site */
+	TagsPage       *bool           `json:"tags_page,omitempty"`           /* Set to false to leave out the page listing every tag at /tags */
+	DraftSecret    string          `json:"draft_secret,omitempty"`        /* Makes draft preview URLs non-guessable, random for each build if empty */
+	ExtraFiles     []ExtraFile     `json:"extra_files,omitempty"`         /* Host specific files which don't fit in assets e.g. _headers or verification files */
+	OutputDir      string          `json:"output_dir,omitempty"`          /* Directory the site is generated into and served from, "docs" by default */
+	EditURLFormat  string          `json:"edit_url_template,omitempty"`   /* Link to edit a post, {path} is replaced by its source path e.g. "https://github.com/me/site/edit/main/{path}" */
+	Hooks          *Hooks          `json:"hooks,omitempty"`
+	Tags           []Tag           `json:"tags,omitempty"`
+	Posts          []Post          `json:"posts,omitempty"`
+	ContentDir     string          `json:"-"` /* Folder the content is read from, set during generate - 'markdown' if empty */
 }
 
 type Post struct {
-	Markdown    []byte   `json:"markdown,omitempty"`
-	HTML        []byte   `json:"html,omitempty"`
-	Layout      string   `json:"layout,omitempty"`
-	Title       string   `json:"title,omitempty"`
-	Date        string   `json:"date,omitempty"`
-	Description string   `json:"description,omitempty"`
-	Tags        []string `json:"tags"`
-	RootName    string   `json:"root_name,omitempty"` /* If post is abc.md, root name is abc */
+	Markdown     []byte                   `json:"markdown,omitempty"`
+	HTML         []byte                   `json:"html,omitempty"`
+	Layout       string                   `json:"layout,omitempty"`
+	Title        string                   `json:"title,omitempty"`
+	Date         string                   `json:"date,omitempty"`
+	Description  string                   `json:"description,omitempty"`
+	SummaryText  string                   `json:"summary,omitempty"` /* Shown on listings instead of the start of the post, the description is for meta tags */
+	Tags         []string                 `json:"tags"`
+	Draft        bool                     `json:"draft,omitempty"`      /* Marks a post as unfinished */
+	Pinned       bool                     `json:"pinned,omitempty"`     /* Lists the post at the top of the blog listing */
+	InFeed       *bool                    `json:"in_feed,omitempty"`    /* Set to false to leave the post out of feeds, included if nil */
+	InSitemap    *bool                    `json:"in_sitemap,omitempty"` /* Set to false to leave the post out of the sitemap, included if nil */
+	NoIndex      bool                     `json:"noindex,omitempty"`    /* Asks search engines not to index the post, also leaving it out of the sitemap */
+	HeadExtra    []string                 `json:"head_extra,omitempty"` /* HTML added as it is to the <head> of this post's page only e.g. a one-off <meta> or <script> */
+	BodyClass    string                   `json:"body_class,omitempty"` /* Added to the class of the page's <body> for styling e.g. "wide" */
+	Cover        string                   `json:"cover,omitempty"`      /* Image in markdown/assets shown with the post and in social previews e.g. "images/cover.png" */
+	Aliases      []string                 `json:"aliases,omitempty"`    /* Old paths of the post e.g. "/blog/old_name", each redirecting to it */
+	NewTabLinks  *bool                    `json:"new_tab,omitempty"`    /* Overrides external_links_new_tab of the config for this post, as configured if nil */
+	RootName     string                   `json:"root_name,omitempty"`  /* If post is abc.md, root name is abc */
+	Permalink    string                   `json:"permalink,omitempty"`  /* Absolute URL of the rendered post, set during generate */
+	HasCode      bool                     `json:"-"`                    /* Whether the rendered post contains code blocks */
+	HasMath      bool                     `json:"-"`                    /* Whether the rendered post contains math */
+	Excerpt      string                   `json:"-"`                    /* Start of the post's text without markup, e.g. a fallback description */
+	Summary      template.HTML            `json:"-"`                    /* HTML of the post up to the excerpt separator, empty if the post has none */
+	Lang         string                   `json:"-"`                    /* Language of the post, from its filename e.g. my_post.fr.md */
+	Translations []Translation            `json:"-"`                    /* All language versions of the post, including itself */
+	InTag        map[string]TagNeighbours `json:"-"`                    /* Previous/next posts sharing each of the post's tags, keyed by tag slug */
+	ResolvedTags []Tag                    `json:"-"`                    /* The post's tags in order, just the slug for tags which were never created */
+	Pages        []Post                   `json:"-"`                    /* Pages listed on a section's listing page */
+	CoverURL     string                   `json:"-"`                    /* Absolute URL of the cover image, set during generate */
+	CoverWidth   int                      `json:"-"`                    /* Intrinsic size of the cover image in pixels, so that browsers can reserve space for it */
+	CoverHeight  int                      `json:"-"`
+	SourcePath   string                   `json:"-"` /* File the post was read from e.g. "markdown/posts/My_Post.md" */
+	ModTime      time.Time                `json:"-"` /* When the file of the post was last modified */
+	DateTime     time.Time                `json:"-"` /* Date parsed e.g. for sorting, zero if the post has no date or it can't be parsed */
+}
+
+/* A link to another post */
+type PostRef struct {
+	Title string
+	URL   string
+}
+
+/* The posts before and after a post within a tag, in chronological order */
+type TagNeighbours struct {
+	Prev *PostRef /* Older post, nil for the first post in the tag */
+	Next *PostRef /* Newer post, nil for the latest post in the tag */
+}
+
+/* A language version of a post */
+type Translation struct {
+	Lang string
+	URL  string
+}
+
+/* Options for a single run of the generate command */
+type GenerateOptions struct {
+	SiteDir string /* Directory the static site is generated into */
+	BaseURL string /* Overrides the URL in config.json when set e.g. when previewing locally */
+	Drafts  bool   /* Also render drafts to unlisted URLs under _drafts */
+	Prune   bool   /* Only remove files which are no longer generated, instead of recreating the site directory */
+	DryRun  bool   /* When pruning, only report what would change */
+	Strict  bool   /* Fail on any warning e.g. a post without content, and before writing anything on tag files which can't be parsed */
+	Force   bool   /* Replace the site directory even if it doesn't look like a generated site */
+	Env     string /* Environment the site is generated for, "production" by default - analytics are only included in production */
+	Jobs    int    /* Number of posts converted and rendered at once, GOMAXPROCS if 0 */
+
+	Progress io.Writer /* Receives the progress of rendering posts, nil to report nothing */
+}
+
+/* Options for serving a generated static site */
+type ServeOptions struct {
+	Dir     string /* Directory containing the generated static site */
+	Port    int    /* Served on localhost only */
+	Addr    string /* host:port to listen on instead of localhost:Port e.g. ":3000" for all interfaces */
+	Open    bool   /* Open the default browser at the site once the server is listening */
+	NoCache bool   /* Tell browsers not to cache anything, so that every refresh shows the latest generated site */
+	Verbose bool   /* Log the path and status of every request */
+}
+
+/* Size of the generated site, printed after generating */
+type SiteSummary struct {
+	Files   int        `json:"files"`
+	Bytes   int64      `json:"bytes"`
+	Largest []FileSize `json:"largest"` /* Largest files first */
+}
+
+type FileSize struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+/* A filesystem the generated site is written to, paths are relative to the root of the site */
+type WriteFS interface {
+	MkdirAll(path string, perm fs.FileMode) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+/* Writes to a directory on disk */
+type dirWriteFS string
+
+func (d dirWriteFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(filepath.Join(string(d), path), perm)
+}
+
+func (d dirWriteFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return writeIfChanged(filepath.Join(string(d), name), data)
+}
+
+/* Remembers the files and folders written through it, so that files left over from an older site can be removed afterwards */
+type recordWriteFS struct {
+	WriteFS
+	written map[string]bool /* Cleaned paths relative to the root of the site */
+}
+
+func (r recordWriteFS) MkdirAll(path string, perm fs.FileMode) error {
+	r.written[filepath.Clean(path)] = true
+	return r.WriteFS.MkdirAll(path, perm)
+}
+
+func (r recordWriteFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	r.written[filepath.Clean(name)] = true
+	return r.WriteFS.WriteFile(name, data, perm)
+}
+
+/***********************
+* Lets pages rendered concurrently write through a single WriteFS one at a time
+* This also keeps the number of files open at once to one, however many pages are being rendered
+************************/
+type lockedWriteFS struct {
+	mu   *sync.Mutex
+	fsys WriteFS
+}
+
+func (l lockedWriteFS) MkdirAll(path string, perm fs.FileMode) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fsys.MkdirAll(path, perm)
+}
+
+func (l lockedWriteFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fsys.WriteFile(name, data, perm)
+}
+
+/* Keeps written files in memory by their slash-separated path e.g. "blog/my_post.html" - directories are implicit */
+type memWriteFS map[string][]byte
+
+func (m memWriteFS) MkdirAll(path string, perm fs.FileMode) error {
+	return nil
+}
+
+func (m memWriteFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m[filepath.ToSlash(filepath.Clean(name))] = bytes.Clone(data)
+	return nil
+}
+
+/* The parsed content of a site */
+type Site struct {
+	Config       Config /* Config + listed posts and tags */
+	Translations []Post /* Posts only linked to from their translations */
+	Drafts       []Post
+	TagErrors    []error /* Tag files which couldn't be parsed and were skipped */
+}
+
+/* Options for previewing the static site */
+type PreviewOptions struct {
+	Port    int
+	Verbose bool /* Log the path and status of every request */
+	Drafts  bool /* Also render drafts, marked as such on their pages */
+}
+
+/***********************
+* The site as seen by templates, the page being rendered gets its own post through .Post
+************************/
+type SiteData struct {
+	Config
+	Icons     map[string]template.HTML /* SVG markup of each icon by name, see loadIcons() */
+	BuildTime time.Time                /* When the site is generated, see buildTime() */
+	Version   string                   /* Version of ez-ssg generating the site */
+	Env       string                   /* Environment the site is generated for e.g. "production", see GenerateOptions */
+}
+
+/* Whether the site is generated for production e.g. to only include analytics there */
+func (s SiteData) IsProduction() bool {
+	return s.Env == ENV_PRODUCTION
+}
+
+/***********************
+* Used inside the blog layout to list posts, grouped by year if the group_posts_by_year config is set
+* Years are sorted newest first and posts keep their order within a year, posts without a date are grouped last
+* Without grouping, all posts are returned as a single group
+************************/
+func (s SiteData) PostGroups() []PostGroup {
+	if !s.GroupByYear {
+		return []PostGroup{{Posts: s.Posts}}
+	}
+
+	groups := []PostGroup{}
+	for _, post := range s.Posts {
+		year := 0
+		if !post.DateTime.IsZero() {
+			year = post.DateTime.Year()
+		}
+		i := slices.IndexFunc(groups, func(g PostGroup) bool { return g.Year == year })
+		if i == -1 {
+			groups = append(groups, PostGroup{Year: year})
+			i = len(groups) - 1
+		}
+		groups[i].Posts = append(groups[i].Posts, post)
+	}
+
+	/* Undated posts have year 0, so they sort last */
+	slices.SortStableFunc(groups, func(a, b PostGroup) int { return b.Year - a.Year })
+	return groups
+}
+
+/* Titles and URLs of the listed posts and pages of sections, e.g. for the 404 page to suggest pages from */
+func (s SiteData) SearchIndex() []PostRef {
+	posts := s.Posts
+	for _, section := range s.Sections {
+		posts = slices.Concat(posts, section.Pages)
+	}
+	index := make([]PostRef, len(posts))
+	for i, post := range posts {
+		index[i] = PostRef{Title: post.Title, URL: post.Permalink}
+	}
+	return index
 }
 
+/***********************
+* Kind of page being rendered, one of the PAGE_ constants
+* Embedded in the content of includes and layouts, so that templates can branch using e.g. {{if .IsPost}}
+************************/
+type PageType string
+
+func (t PageType) IsHome() bool     { return t == PAGE_HOME }
+func (t PageType) IsBlog() bool     { return t == PAGE_BLOG }
+func (t PageType) IsPost() bool     { return t == PAGE_POST }
+func (t PageType) IsTag() bool      { return t == PAGE_TAG }
+func (t PageType) IsSection() bool  { return t == PAGE_SECTION }
+func (t PageType) IsTags() bool     { return t == PAGE_TAGS }
+func (t PageType) IsNotFound() bool { return t == PAGE_NOT_FOUND }
+
 type IncludesContent struct {
-	Site Config
+	Site SiteData
 	Post Post
+	PageType
+	CurrentURL string /* Absolute URL of the page being rendered */
+	Year       int    /* Year the site is generated in */
 }
 
 type LayoutContent struct {
-	Includes map[string]template.HTML
-	Content  template.HTML
-	Site     Config
-	Post     Post
-	Tag      Tag
+	Includes   map[string]template.HTML
+	Content    template.HTML
+	Site       SiteData
+	Post       Post
+	Tag        Tag
+	Posts      []Post     /* Posts listed on the page e.g. those of the tag on a tag page */
+	Pagination Pagination /* Set on listing pages which may be split into several pages e.g. tag pages */
+	PageType
+	CurrentURL string /* Absolute URL of the page being rendered */
 }
 
 const (
 	/* Files and directories */
-	CONFIG_FILE  = "config.json"
-	INDEX_FILE   = "index.md"
-	BLOG_FILE    = "blog.md"
-	MARKDOWN_DIR = "markdown"
-	INCLUDES_DIR = "includes"
-	LAYOUTS_DIR  = "layouts"
-	SITE_DIR     = "docs"
-	ASSETS_DIR   = "assets"
+	CONFIG_FILE   = "config.json"
+	INDEX_FILE    = "index.md"
+	BLOG_FILE     = "blog.md"
+	NOTFOUND_FILE = "404.md"
+	MARKDOWN_DIR  = "markdown"
+	INCLUDES_DIR  = "includes"
+	LAYOUTS_DIR   = "layouts"
+	SITE_DIR      = "docs"
+	ASSETS_DIR    = "assets"
+	ICONS_DIR     = "icons"
+	SITE_MARKER   = ".ez-ssg" /* Written into every generated site, generate refuses to replace a non-empty directory without it */
+
+	/* Maps the aliases of posts to their paths in generated sites, so that serve can redirect them */
+	ALIASES_FILE = ".ez-ssg-aliases.json"
 
 	/* Includes keywords */
 	INCLUDES_HEAD       = "Head"
@@ -96,6 +478,28 @@ const (
 
 	/* Frontmatter boundary */
 	FRONTMATTER_BOUNDARY = "------------------"
+
+	/* Environments a site is generated for - any other name can be passed too */
+	ENV_PRODUCTION  = "production"
+	ENV_DEVELOPMENT = "development"
+
+	/* Page types - lets includes and layouts know what kind of page is being rendered */
+	PAGE_HOME      = "home"
+	PAGE_BLOG      = "blog"
+	PAGE_POST      = "post"
+	PAGE_TAG       = "tag"
+	PAGE_SECTION   = "section"
+	PAGE_TAGS      = "tags"
+	PAGE_NOT_FOUND = "404"
+
+	/* Maximum length of a post's excerpt, in characters */
+	EXCERPT_LENGTH = 160
+
+	/* ANSI colors of CLI output */
+	COLOR_RED    = "\033[31m"
+	COLOR_GREEN  = "\033[32m"
+	COLOR_YELLOW = "\033[33m"
+	COLOR_RESET  = "\033[0m"
 )
 
 var commands map[string]string = map[string]string{
@@ -103,13 +507,25 @@ var commands map[string]string = map[string]string{
 	"generate": "Generates the static site. Use it when you have all the content ready to generate HTML.",
 	"post":     "Creates a new post",
 	"tag":      "Creates one/multiple new tags under which posts can be classified.",
-	"serve":    "Serves the static files generated in a local HTTP server - to be used after generate command to view the output. Port number 3000 by default in GUI",
+	"serve":    "Serves the static files generated in a local HTTP server - to be used after generate command to view the output. Port number 3000 by default.",
+	"preview":  "Generates the static site into a temporary directory, serves it and opens it in your browser. Your docs folder is left untouched.",
+	"migrate":  "Migrates Jekyll/Hugo posts (markdown with YAML frontmatter) from a directory into markdown/posts.",
+	"validate": "Checks the frontmatter of all posts and pages and the metadata of all tags, reporting every malformed file. Use it before generating the site.",
+	"lint":     "Checks posts and pages for common content issues - missing titles and descriptions, broken images, skipped heading levels and trailing whitespace.",
+	"publish":  "Publishes a draft post by setting draft to false and stamping today's date.",
+	"export":   "Prints the parsed site - config, posts metadata and tags - as JSON for external tools.",
+	"doctor":   "Checks the config, content directories, posts and tags and the site directory, printing a checklist of what's wrong. Start here if generate fails.",
+	"version":  "Prints the version of ez-ssg, the commit it was built from and the Go version. Include it in bug reports.",
 }
 
-/* Fully rendered html for header, footer, etc */
-var includesRender map[string]template.HTML = map[string]template.HTML{}
+/* Commands which take arguments the GUI has no inputs for */
+var cliOnlyCommands []string = []string{"migrate", "validate", "lint", "publish", "export", "doctor", "version"}
+
 var specialFiles []string = []string{INDEX_FILE, BLOG_FILE}
 
+/* Config files in the order they are looked for - config.json wins if there are several */
+var configFiles []string = []string{CONFIG_FILE, "config.yaml", "config.yml", "config.toml"}
+
 //go:embed includes/*
 var includesEFS embed.FS
 
@@ -119,11 +535,61 @@ var layoutsEFS embed.FS
 //go:embed assets/*
 var assetsEFS embed.FS // contains style.css file for website's css + a sample favicon
 
+//go:embed icons/*
+var iconsEFS embed.FS // SVG icons which can be inlined in templates using {{ icon "<name>" }}
+
+/* BCP-47 language tags e.g. "en", "pt-BR" or "zh-Hant" */
+var langRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+/* Markdown snippets included in posts e.g. {{% include "disclaimer.md" %}} */
+var includeRegex = regexp.MustCompile(`\{\{%\s*include\s+"([^"]+)"\s*%\}\}`)
+
+/* Returned (wrapped) when generate refuses to replace a site directory, see checkSiteDir() */
+var errNotGeneratedSite = errors.New("it doesn't look like a site generated by ez-ssg")
+
+/* Set when the GUI's generate was refused, so that running generate again right away replaces the directory */
+var guiForceGenerate bool
+
+/* Dates as stored in frontmatter e.g. "Feb 21st, 2024" */
+var storedDateRegex = regexp.MustCompile(`^([A-Z][a-z]{2}) (\d{1,2})(?:st|nd|rd|th), (\d{4})$`)
+
+/* Named presets for the date_format config */
+var dateFormats = map[string]string{
+	"iso":  "2006-01-02",
+	"long": "2 January 2006",
+	"us":   "January 2, 2006",
+}
+
+/* Content types of files served locally which Go, or the OS, may not know about - others come from mime.TypeByExtension */
+var contentTypes = map[string]string{
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".webmanifest": "application/manifest+json",
+	".ico":         "image/x-icon",
+	".avif":        "image/avif",
+	".webp":        "image/webp",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".txt":         "text/plain; charset=utf-8",
+}
+
+/* Favicons generated from the favicon config, by filename */
+var faviconSizes = map[string]int{
+	"favicon-16x16.png":    16,
+	"favicon-32x32.png":    32,
+	"apple-touch-icon.png": 180,
+	"favicon-192x192.png":  192,
+}
+
 /* Samples */
 var sampleCfg Config = Config{
-	Title:       "chettriyuvraj",
-	Description: "Yuvraj Chettri's personal blog",
-	URL:         "http://localhost:3000",
+	Title:         "chettriyuvraj",
+	Description:   "Yuvraj Chettri's personal blog",
+	URL:           "http://localhost:3000",
+	Language:      "en",
+	TextDirection: "ltr",
 	SpecialLinks: []Link{
 		{
 			URL:         "https://www.linkedin.com/in/yuvraj-chettri/",
@@ -154,10 +620,34 @@ var (
 * depending on which command is passed
 ************************/
 
+var logger *log.Logger = log.New(os.Stderr, "", 0)
+
+/* "auto" colors output written to a terminal unless NO_COLOR is set, "always" and "never" override it */
+var colorMode string = "auto"
+
+/* Set when building a release e.g. go build -ldflags "-X main.version=v2.1.0 -X main.commit=$(git rev-parse --short HEAD)" */
+var (
+	version = "dev"
+	commit  = ""
+)
+
+/* Number of warnings printed so far, so that generating with --strict can fail on any of them */
+var warnings atomic.Int64
+
+/* The current time, replaced in tests to pin dates e.g. of new posts */
+var now = time.Now
+
 func main() {
-	logger := log.New(os.Stderr, "", 0)
 	var err error
 
+	/* --no-color/--force-color apply to every command, so they are taken out before parsing the command */
+	os.Args = parseColorFlags(os.Args)
+
+	if len(os.Args) == 2 && (os.Args[1] == "--version" || os.Args[1] == "-V") {
+		fmt.Println(versionString())
+		return
+	}
+
 	/* If no args passed, display help screen */
 	if len(os.Args) == 1 {
 		log.Fatal(help())
@@ -180,47 +670,417 @@ func main() {
 	/* Parse args and execute command */
 	switch cmd {
 	case "init":
-		err = initialize()
+		flags := newFlagSet(cmd)
+		format := flags.String("format", "json", "")
+		withExamples := flags.Bool("with-examples", false, "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		if flagsErr != nil || len(args) > 0 || !slices.Contains([]string{"json", "yaml", "toml"}, *format) {
+			logger.Fatalf(help())
+		}
+		err = initialize(*format, *withExamples)
 
 	case "generate":
-		err = generateStaticSite()
+		flags := newFlagSet(cmd)
+		drafts := flags.Bool("drafts", false, "")
+		strict := flags.Bool("strict", false, "")
+		force := flags.Bool("force", false, "")
+		quiet := flags.Bool("quiet", false, "")
+		prune := flags.Bool("prune", false, "")
+		dryRun := flags.Bool("dry-run", false, "")
+		asJSON := flags.Bool("json", false, "")
+		cpuProfile := flags.String("profile", "", "")
+		memProfile := flags.String("memprofile", "", "")
+		output := flags.String("output", "", "")
+		env := flags.String("env", ENV_PRODUCTION, "")
+		dumpAST := flags.String("dump-ast", "", "")
+		jobs := flags.Int("jobs", 0, "")
+		if _, flagsErr := parseFlags(flags, os.Args[2:]); flagsErr != nil || (*dryRun && !*prune) || *env == "" || *jobs < 0 {
+			logger.Fatalf(help())
+		}
+		if *dumpAST != "" {
+			err = dumpMarkdownAST(os.Stdout, *dumpAST)
+			break
+		}
+		opts := GenerateOptions{SiteDir: cmp.Or(*output, outputDir()), Drafts: *drafts, Prune: *prune, DryRun: *dryRun, Strict: *strict, Force: *force, Env: *env, Jobs: *jobs}
+		if !*quiet {
+			opts.Progress = os.Stderr
+		}
+		err = profile(*cpuProfile, *memProfile, func() error {
+			return generateStaticSite(opts)
+		})
+		if err == nil && !*dryRun {
+			err = printSiteSummary(opts.SiteDir, *asJSON)
+		}
 
 	case "post":
 		if len(os.Args) < 3 {
 			logger.Fatalf(help())
 		}
 
-		title := os.Args[2]
-		tags := []string{}
-		if len(os.Args) < 5 || os.Args[3] != "-t" {
-			createPost(title, tags)
-			return
+		/* Subcommands of post - a title with the same name has to come after "--" */
+		if os.Args[2] == "retag" {
+			flags := newFlagSet(cmd)
+			var add, remove listFlag
+			flags.Var(&add, "add", "")
+			flags.Var(&remove, "remove", "")
+			args, flagsErr := parseFlags(flags, os.Args[3:])
+			if flagsErr != nil || len(args) != 1 || (len(add) == 0 && len(remove) == 0) {
+				logger.Fatalf(help())
+			}
+			err = retagPost(args[0], add, remove)
+			break
 		}
 
-		tags = os.Args[4:]
-		err = createPost(title, tags)
+		titles, tags, argsErr := parsePostArgs(os.Args[2:])
+		if argsErr != nil {
+			logger.Fatalf(help())
+		}
+		err = createPosts(titles, tags)
 	case "tag":
-		if len(os.Args) < 3 {
+		flags := newFlagSet(cmd)
+		name := flags.String("name", "", "")
+		description := flags.String("description", "", "")
+		flags.StringVar(description, "desc", "", "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		if flagsErr != nil || len(args) < 1 {
+			logger.Fatalf(help())
+		}
+		/* A name/description only makes sense for a single tag */
+		if (*name != "" || *description != "") && len(args) > 1 {
 			logger.Fatalf(help())
 		}
 
-		tags := os.Args[2:]
+		tags := []Tag{}
+		for _, slug := range args {
+			tags = append(tags, Tag{Slug: slug, Name: *name, Description: *description})
+		}
 		err = createTag(tags)
 
 	case "serve":
+		flags := newFlagSet(cmd)
+		open := flags.Bool("open", false, "")
+		addr := flags.String("addr", "", "")
+		noCache := flags.Bool("no-cache", false, "")
+		verbose := flags.Bool("verbose", false, "")
+		output := flags.String("output", "", "")
+		/* -1 until a port is passed using --port */
+		port := -1
+		flags.IntVar(&port, "port", -1, "")
+		flags.IntVar(&port, "p", -1, "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		/* The port is either passed using --port or as the argument, not both */
+		if flagsErr != nil || len(args) > 1 || (len(args) == 1 && port != -1) || (port != -1 && !validPort(port)) {
+			logger.Fatalf(help())
+		}
+		if len(args) > 0 {
+			var portErr error
+			if port, portErr = parsePort(args[0]); portErr != nil {
+				logger.Fatalf(help())
+			}
+		}
+		/* --addr takes precedence over the port, which is 3000 if neither is given */
+		if port == -1 {
+			port = 3000
+		}
+		err = serveStaticSite(ServeOptions{Dir: cmp.Or(*output, outputDir()), Port: port, Addr: *addr, Open: *open, NoCache: *noCache, Verbose: *verbose})
+
+	case "preview":
+		flags := newFlagSet(cmd)
+		verbose := flags.Bool("verbose", false, "")
+		drafts := flags.Bool("drafts", false, "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		if flagsErr != nil {
+			logger.Fatalf(help())
+		}
+		port := 3000
+		if len(args) > 0 {
+			var portErr error
+			if port, portErr = parsePort(args[0]); portErr != nil {
+				logger.Fatalf(help())
+			}
+		}
+		err = previewStaticSite(PreviewOptions{Port: port, Verbose: *verbose, Drafts: *drafts})
+
+	case "migrate":
 		if len(os.Args) < 3 {
 			logger.Fatalf(help())
 		}
-		portStr := os.Args[2]
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
+		err = migrate(os.Args[2])
+
+	case "validate":
+		err = validate()
+
+	case "lint":
+		flags := newFlagSet(cmd)
+		var skip listFlag
+		flags.Var(&skip, "skip", "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		if flagsErr != nil || len(args) > 0 {
+			logger.Fatalf(help())
+		}
+		err = lint(skip)
+
+	case "publish":
+		flags := newFlagSet(cmd)
+		date := flags.String("date", "", "")
+		generate := flags.Bool("generate", false, "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		if flagsErr != nil || len(args) != 1 {
+			logger.Fatalf(help())
+		}
+		publishDate := now()
+		if *date != "" {
+			var dateErr error
+			if publishDate, dateErr = parseDateFlag(*date); dateErr != nil {
+				logger.Fatal(dateErr)
+			}
+		}
+		err = publishPost(args[0], publishDate)
+		if err == nil && *generate {
+			err = generateStaticSite(GenerateOptions{SiteDir: outputDir()})
+		}
+
+	case "export":
+		flags := newFlagSet(cmd)
+		asJSON := flags.Bool("json", false, "")
+		args, flagsErr := parseFlags(flags, os.Args[2:])
+		/* JSON is the only format for now, the flag keeps room for others */
+		if flagsErr != nil || len(args) > 0 || !*asJSON {
+			logger.Fatalf(help())
+		}
+		err = exportSite(os.Stdout)
+
+	case "doctor":
+		err = doctor()
+
+	case "version":
+		if len(os.Args) > 2 {
 			logger.Fatalf(help())
 		}
-		err = serveStaticSite(port)
+		fmt.Println(versionString())
 	}
 
 	if err != nil {
-		logger.Fatal(err)
+		logger.Fatal(colorize(os.Stderr, COLOR_RED, err.Error()))
+	}
+}
+
+/***********************
+* Sets colorMode from --no-color/--force-color anywhere in args before "--", returning args without them
+* --no-color wins if both are passed
+************************/
+func parseColorFlags(args []string) []string {
+	var rest []string
+	noColor, forceColor := false, false
+	for i, arg := range args {
+		/* Arguments after "--" are left to the command, even if they look like color flags */
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch arg {
+		case "--no-color", "-no-color":
+			noColor = true
+		case "--force-color", "-force-color":
+			forceColor = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	switch {
+	case noColor:
+		colorMode = "never"
+	case forceColor:
+		colorMode = "always"
+	}
+	return rest
+}
+
+/***********************
+* Wraps s in an ANSI color if output written to f should be colored
+* In "auto" mode, only terminals get colors and NO_COLOR (https://no-color.org) turns them off
+************************/
+func colorize(f *os.File, color string, s string) string {
+	useColor := colorMode == "always"
+	if colorMode == "auto" && os.Getenv("NO_COLOR") == "" {
+		useColor = isTerminal(f)
+	}
+	if !useColor {
+		return s
+	}
+	return color + s + COLOR_RESET
+}
+
+/* Reports whether f is a terminal rather than e.g. a file or a pipe */
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+/***********************
+* Reports progress of a long running loop e.g. rendering posts
+* Redraws a progress bar in place on a terminal, otherwise writes a line per step so that logs stay readable
+* A nil *progress reports nothing
+************************/
+type progress struct {
+	mu    sync.Mutex /* Steps are reported by concurrent workers */
+	w     io.Writer
+	bar   bool
+	label string
+	total int
+	done  int
+}
+
+func newProgress(w io.Writer, label string, total int) *progress {
+	if w == nil || total == 0 {
+		return nil
+	}
+	f, ok := w.(*os.File)
+	return &progress{w: w, bar: ok && isTerminal(f), label: label, total: total}
+}
+
+/* Marks one more step as done, name describes it e.g. the file written */
+func (p *progress) step(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if !p.bar {
+		fmt.Fprintf(p.w, "%s %d/%d: %s\n", p.label, p.done, p.total, name)
+		return
+	}
+	const width = 30
+	filled := width * p.done / p.total
+	fmt.Fprintf(p.w, "\r[%s%s] %d/%d %s", strings.Repeat("#", filled), strings.Repeat("-", width-filled), p.done, p.total, p.label)
+}
+
+/* Ends the progress bar's line, so that whatever is printed next - e.g. an error - starts on a new one */
+func (p *progress) stop() {
+	if p != nil && p.bar && p.done > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+/***********************
+* Returns the version of ez-ssg and the commit it was built from
+* Falls back to what the Go toolchain recorded when they weren't set using -ldflags e.g. when installed using 'go install'
+************************/
+func versionInfo() (ver string, rev string) {
+	ver, rev = version, commit
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ver, rev
+	}
+	if ver == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		ver = info.Main.Version
+	}
+	if rev == "" {
+		var modified bool
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				rev = setting.Value[:min(12, len(setting.Value))]
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if rev != "" && modified {
+			rev += "-dirty"
+		}
+	}
+	return ver, rev
+}
+
+/* Describes the build for the version command e.g. "ez-ssg v2.1.0 (commit 1a2b3c4d5e6f, go1.22.1 linux/amd64)" */
+func versionString() string {
+	ver, rev := versionInfo()
+	return fmt.Sprintf("ez-ssg %s (commit %s, %s %s/%s)", ver, cmp.Or(rev, "unknown"), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+/***********************
+* Runs fn while writing a CPU profile to cpuPath, then writes a heap profile to memPath
+* Either path may be empty to skip that profile
+* Inspect the profiles using 'go tool pprof <profile>'
+************************/
+func profile(cpuPath string, memPath string, fn func() error) error {
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return fmt.Errorf("error creating cpu profile: %w", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("error starting cpu profile: %w", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	if memPath != "" {
+		f, err := os.Create(memPath)
+		if err != nil {
+			return fmt.Errorf("error creating memory profile: %w", err)
+		}
+		defer f.Close()
+		/* Up-to-date statistics of what is still allocated */
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf("error writing memory profile: %w", err)
+		}
+	}
+	return nil
+}
+
+/***********************
+* Creates a flag set for the flags of a command
+* Errors are reported by the caller along with the help screen
+************************/
+func newFlagSet(cmd string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.Usage = func() {}
+	return flags
+}
+
+/***********************
+* A flag which may be repeated and/or hold comma-separated values
+* e.g. '--add golang --add python' or '--add golang,python'
+************************/
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+/***********************
+* Parses the flags of a command which may appear before, after or in between its arguments
+* e.g. both 'ez-ssg serve 3000 --open' and 'ez-ssg serve --open 3000'
+* Returns the remaining (non-flag) arguments
+************************/
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
 	}
 }
 
@@ -233,11 +1093,13 @@ func main() {
 * Run this the very first time you use the tool.
 *
 * Initializes the following essentials for our static site:
-* 1. A 'markdown' directory which contains sub-directories for posts, tags and assets
+* 1. A 'markdown' directory which contains sub-directories for posts, tags, assets and included snippets
 * 2. A sample config.json file which contains necessary metadata for our website, needs to be filled by user
+*    The config is written as config.yaml or config.toml instead if format is "yaml" or "toml"
 * 3. 'index' and 'blog' markdown files, which will contain text and metadata for the homepage and blog listing page
+* 4. With examples, a sample post and tag so that the generated site has something to show - see createExamples()
 ************************/
-func initialize() error {
+func initialize(format string, examples bool) error {
 
 	/* Initialize directories */
 	if err := os.MkdirAll(filepath.Join(MARKDOWN_DIR, "posts"), 0750); err != nil {
@@ -249,6 +1111,9 @@ func initialize() error {
 	if err := os.MkdirAll(filepath.Join(MARKDOWN_DIR, "assets", "images"), 0750); err != nil {
 		return fmt.Errorf("error creating markdown/assets/images folder: %w", err)
 	}
+	if err := os.MkdirAll(filepath.Join(MARKDOWN_DIR, INCLUDES_DIR), 0750); err != nil {
+		return fmt.Errorf("error creating markdown/includes folder: %w", err)
+	}
 
 	/* Initialize default files with sample data */
 	/* Config file */
@@ -289,6 +1154,18 @@ func initialize() error {
 	}
 
 	configFilepath := CONFIG_FILE
+	switch format {
+	case "yaml":
+		configFilepath = "config.yaml"
+		if cfg, err = jsonToYAML(cfg); err != nil {
+			return fmt.Errorf("error converting sample config to yaml: %w", err)
+		}
+	case "toml":
+		configFilepath = "config.toml"
+		if cfg, err = jsonToTOML(cfg); err != nil {
+			return fmt.Errorf("error converting sample config to toml: %w", err)
+		}
+	}
 	if err := os.WriteFile(configFilepath, []byte{}, 0755); err != nil {
 		return fmt.Errorf("error creating file %s: %w", configFilepath, err)
 	}
@@ -296,17 +1173,61 @@ func initialize() error {
 		return fmt.Errorf("error creating file %s: %w", configFilepath, err)
 	}
 
+	if examples {
+		return createExamples()
+	}
 	return nil
 }
 
 /***********************
-* Creates a post in the 'markdown/posts' folder.
-* Any tags passed must be created first using createTag() command
-* If a particular tag has not been created, it will not be visible on the static site.
-*
-* A post is stored as a markdown file with frontmatter - it has the following metadata as frontmatter:
-* 1. Title (Mandatory)
-* 2. Date (Auto-generated)
+* Creates a sample post tagged with a sample tag, to learn the format of posts and tags from
+* Both can be edited or deleted like any other post/tag
+************************/
+func createExamples() error {
+	if err := createTag([]Tag{{Slug: "ez-ssg", Name: "ez-ssg", Description: "Posts about building this site"}}); err != nil {
+		return err
+	}
+
+	post := Post{
+		Title:       "Hello World",
+		Date:        formatDate(now()),
+		Description: "My first post, written in markdown",
+		Tags:        []string{"ez-ssg"},
+	}
+	metadata, err := json.MarshalIndent(post, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling example post metadata to json: %w", err)
+	}
+	body := []byte(strings.Join([]string{
+		"",
+		"This is an example post - edit it, or delete it along with markdown/tags/ez-ssg.json once you have written your own.",
+		"",
+		"Everything between the lines of dashes above is the post's metadata, and everything below is its content, written in **markdown**:",
+		"",
+		"- Link to [another post](post:Hello_World) or to [a tag](tag:ez-ssg)",
+		"- Add images to markdown/assets/images and show them using `![a photo](/assets/images/photo.png)`",
+		"- Show code in fenced blocks:",
+		"",
+		"```go",
+		`fmt.Println("Hello World")`,
+		"```",
+		"",
+	}, "\n"))
+	path := postPath(post.Title)
+	if err := writePost(path, metadata, body); err != nil {
+		return fmt.Errorf("error creating example post %s: %w", path, err)
+	}
+	return nil
+}
+
+/***********************
+* Creates a post in the 'markdown/posts' folder.
+* Any tags passed must be created first using createTag() command
+* If a particular tag has not been created, it will not be visible on the static site.
+*
+* A post is stored as a markdown file with frontmatter - it has the following metadata as frontmatter:
+* 1. Title (Mandatory)
+* 2. Date (Auto-generated)
 * 3. Tags (Optional)
 ************************/
 func createPost(title string, tags []string) error {
@@ -314,13 +1235,15 @@ func createPost(title string, tags []string) error {
 		return fmt.Errorf("no title provided")
 	}
 
-	filename := strings.ReplaceAll(title, " ", "_")
-	filepath := filepath.Join(MARKDOWN_DIR, "posts", fmt.Sprintf("%s.md", filename))
+	filepath := postPath(title)
+	if _, err := os.Stat(filepath); err == nil {
+		return fmt.Errorf("post file %s already exists", filepath)
+	}
 
 	metadata := Post{
 		Title: title,
 		Tags:  tags,
-		Date:  formatDate(time.Now()),
+		Date:  formatDate(now()),
 	}
 	rawMetadata, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
@@ -331,9 +1254,212 @@ func createPost(title string, tags []string) error {
 		return fmt.Errorf("error creating post file %s: %w", filepath, err)
 	}
 
+	/* Make sure the post we just wrote can be read back */
+	frontmatter, _, err := readPost(filepath)
+	if err != nil {
+		return fmt.Errorf("error reading back post file %s: %w", filepath, err)
+	}
+	if err := verifyRoundTrip(rawMetadata, frontmatter, &Post{}); err != nil {
+		return fmt.Errorf("error verifying post file %s: %w", filepath, err)
+	}
+
+	return nil
+}
+
+/***********************
+* Splits the arguments of the post command into titles and tags
+* Titles come first, tags for all of them after -t
+* A leading "--" lets titles be named like a subcommand, e.g. post -- retag
+************************/
+func parsePostArgs(args []string) (titles []string, tags []string, err error) {
+	titles, tags = args, []string{}
+	if len(titles) > 0 && titles[0] == "--" {
+		titles = titles[1:]
+	}
+	if i := slices.Index(titles, "-t"); i != -1 {
+		titles, tags = titles[:i], titles[i+1:]
+	}
+	if i := slices.Index(titles, "--no-tags"); i != -1 {
+		if len(tags) > 0 {
+			return nil, nil, errors.New("--no-tags can't be used with -t")
+		}
+		titles = slices.Delete(titles, i, i+1)
+	}
+	if len(titles) == 0 {
+		return nil, nil, errors.New("no titles given")
+	}
+	return titles, tags, nil
+}
+
+/***********************
+* Creates several posts with the same tags
+* A post which can't be created is reported without stopping the others from being created
+************************/
+func createPosts(titles []string, tags []string) error {
+	failed := 0
+	for _, title := range titles {
+		if err := createPost(title, tags); err != nil {
+			reportError("error creating post %q: %s", title, err)
+			failed++
+			continue
+		}
+		success("created %s", postPath(title))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to create %d of %d posts", failed, len(titles))
+	}
+	return nil
+}
+
+/***********************
+* Adds tags to and removes tags from an existing post, keeping the rest of the post as is
+* Tags being added must have been created using createTag() first
+************************/
+func retagPost(title string, add []string, remove []string) error {
+	path := postPath(title)
+	frontmatter, body, err := readPost(path)
+	if err != nil {
+		return fmt.Errorf("error reading post %s: %w", path, err)
+	}
+	var post Post
+	if err := json.Unmarshal(frontmatter, &post); err != nil {
+		return fmt.Errorf("error unmarshaling metadata of post %s: %w", path, err)
+	}
+
+	for _, tag := range add {
+		tag = strings.ToLower(tag)
+		if _, err := os.Stat(filepath.Join(MARKDOWN_DIR, "tags", fmt.Sprintf("%s.json", tag))); err != nil {
+			return fmt.Errorf("tag %s does not exist, create it first using the tag command", tag)
+		}
+		if !slices.Contains(post.Tags, tag) {
+			post.Tags = append(post.Tags, tag)
+		}
+	}
+	for _, tag := range remove {
+		tag = strings.ToLower(tag)
+		if !slices.Contains(post.Tags, tag) {
+			warn("post %s is not tagged %s", title, tag)
+			continue
+		}
+		post.Tags = slices.DeleteFunc(post.Tags, func(t string) bool { return t == tag })
+	}
+
+	rawMetadata, err := json.MarshalIndent(post, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling post metadata to json: %w", err)
+	}
+	if err := writePost(path, rawMetadata, body); err != nil {
+		return fmt.Errorf("error writing post file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+/***********************
+* Publishes a draft - sets draft to false and the date of the post to the date passed
+* The rest of the post is kept as is
+************************/
+func publishPost(title string, date time.Time) error {
+	path := postPath(title)
+	frontmatter, body, err := readPost(path)
+	if err != nil {
+		return fmt.Errorf("error reading post %s: %w", path, err)
+	}
+	var post Post
+	if err := json.Unmarshal(frontmatter, &post); err != nil {
+		return fmt.Errorf("error unmarshaling metadata of post %s: %w", path, err)
+	}
+	if !post.Draft {
+		warn("post %s is not a draft", title)
+	}
+
+	post.Draft = false
+	post.Date = formatDate(date)
+	rawMetadata, err := json.MarshalIndent(post, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling post metadata to json: %w", err)
+	}
+	if err := writePost(path, rawMetadata, body); err != nil {
+		return fmt.Errorf("error writing post file %s: %w", path, err)
+	}
+
+	success("published %s on %s", title, post.Date)
 	return nil
 }
 
+/***********************
+* Returns the path of the markdown file of a post, the same way createPost() names it
+* An existing post may have any of the configured extensions e.g. .markdown, new posts are .md
+************************/
+func postPath(title string) string {
+	filename := strings.ReplaceAll(title, " ", "_")
+	return pagePath(filepath.Join(MARKDOWN_DIR, "posts"), filename+".md", contentExtensions())
+}
+
+/***********************
+* Returns the extensions of posts and pages without the leading dot, "md" and "markdown" unless configured
+************************/
+func postExtensions(cfg Config) []string {
+	if len(cfg.PostExtensions) == 0 {
+		return []string{"md", "markdown"}
+	}
+	exts := make([]string, len(cfg.PostExtensions))
+	for i, ext := range cfg.PostExtensions {
+		exts[i] = strings.TrimPrefix(ext, ".")
+	}
+	return exts
+}
+
+/***********************
+* Same as postExtensions() for commands which don't otherwise need the config
+* Falls back to the defaults if the config can't be read, it is up to the caller to report config problems
+************************/
+func contentExtensions() []string {
+	cfg, _ := loadConfig()
+	return postExtensions(cfg)
+}
+
+/***********************
+* Returns the directory the site is generated into and served from - output_dir in the config, SITE_DIR by default
+* Falls back to SITE_DIR if the config can't be read, it is up to the caller to report config problems
+************************/
+func outputDir() string {
+	cfg, _ := loadConfig()
+	return cmp.Or(cfg.OutputDir, SITE_DIR)
+}
+
+/***********************
+* Returns the paths of the posts or pages in dir with any of the extensions, sorted
+************************/
+func globPages(dir string, exts []string) ([]string, error) {
+	var paths []string
+	for _, ext := range exts {
+		matches, err := filepath.Glob(filepath.Join(dir, "*."+ext))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+/***********************
+* Returns the path of the page name (e.g. "index.md") in dir, with whichever of the extensions it exists with
+* If it doesn't exist with any of them, dir/name is returned as is
+************************/
+func pagePath(dir string, name string, exts []string) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, ext := range exts {
+		path := filepath.Join(dir, base+"."+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, name)
+}
+
 /***********************
 * Creates a tag in the 'markdown/tags' folder.
 * Once a tag has been created, it is displayed in the 'blog' section as a hashtag.
@@ -341,14 +1467,16 @@ func createPost(title string, tags []string) error {
 *
 * A tag is stored as a simple json file and has the following fields:
 * 1. Slug
+* 2. Name (Optional)
+* 3. Description (Optional)
 ************************/
-func createTag(tags []string) error {
+func createTag(tags []Tag) error {
 	for _, t := range tags {
-		slug := strings.ToLower(t)
-		filename := fmt.Sprintf("%s.json", slug)
+		t.Slug = strings.ToLower(t.Slug)
+		filename := fmt.Sprintf("%s.json", t.Slug)
 		filepath := filepath.Join(MARKDOWN_DIR, "tags", filename)
 
-		raw, err := json.MarshalIndent(Tag{Slug: slug}, "", "  ")
+		raw, err := json.MarshalIndent(t, "", "  ")
 		if err != nil {
 			return fmt.Errorf("error marshaling tag data to json: %w", err)
 		}
@@ -356,238 +1484,1942 @@ func createTag(tags []string) error {
 		if err := os.WriteFile(filepath, raw, 0755); err != nil {
 			return fmt.Errorf("error creating tag file %s: %w", filepath, err)
 		}
+
+		/* Make sure the tag we just wrote can be read back */
+		written, err := read(filepath)
+		if err != nil {
+			return fmt.Errorf("error reading back tag file %s: %w", filepath, err)
+		}
+		if err := verifyRoundTrip(raw, written, &Tag{}); err != nil {
+			return fmt.Errorf("error verifying tag file %s: %w", filepath, err)
+		}
 	}
 
 	return nil
 }
 
 /***********************
-* Generates static site using data in the content folder: 'markdown'
+* Checks all content for malformed metadata and reports every problem found in one pass
 *
-* 1. Deletes old static site directory and creates a fresh one
-* 2. Creates a 'Config' struct that contains both config + content (posts, tags) for the website
-* 3. Render special pages i.e. homepage and blog listings page
+* 1. Posts + special pages - their JSON frontmatter must parse into a post
+* 2. Tags - their JSON files must parse into a tag
 *
+* Unknown fields are reported as well since they are usually typos e.g. "tittle"
+* Problems are reported in the form <file>:<line>: <problem>
 ************************/
-func generateStaticSite() error {
-	/* Delete old directory and create a fresh one */
-	if err := resetStaticSite(); err != nil {
-		return fmt.Errorf("error resetting site directory: %w", err)
+func validate() error {
+	problems, checked, err := validateContent()
+	if err != nil {
+		return err
 	}
 
-	/* Copy over 'markdown/assets' folder into site directory */ // Copy the entire assets directory
-
-	sourceAssetsPath := filepath.Join(MARKDOWN_DIR, ASSETS_DIR)
-	targetAssetsPath := filepath.Join(SITE_DIR, ASSETS_DIR)
-	if err := copyDir(sourceAssetsPath, targetAssetsPath); err != nil {
-		return fmt.Errorf("error copying assets directory from markdown to site: %w", err)
+	for _, problem := range problems {
+		reportError("%s", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d invalid file(s)", len(problems))
 	}
 
-	/* This config struct contains both config + content (posts, tags) */
-	/* Think of this as a master struct */
-	var cfg Config
+	success("all %d posts, pages and tags are valid", checked)
+	return nil
+}
 
-	/* Parse config file and unmarshal into cfg struct */
-	f, err := os.Open(CONFIG_FILE)
+/***********************
+* Returns every problem found in posts, special pages and tags, along with the number of files checked
+* See validate()
+************************/
+func validateContent() (problems []string, checked int, err error) {
+	exts := contentExtensions()
+	postsPaths, err := globPages(filepath.Join(MARKDOWN_DIR, "posts"), exts)
 	if err != nil {
-		return fmt.Errorf("error opening config file: %w", err)
+		return nil, 0, fmt.Errorf("error finding posts: %w", err)
 	}
-	defer f.Close()
-
-	cfgRaw, err := io.ReadAll(f)
-	if err != nil {
-		return fmt.Errorf("error reading config file: %w", err)
+	for _, name := range specialFiles {
+		postsPaths = append(postsPaths, pagePath(MARKDOWN_DIR, name, exts))
 	}
-
-	err = json.Unmarshal(cfgRaw, &cfg)
-	if err != nil {
-		return fmt.Errorf("error unmarshaling config file: %w", err)
+	notFoundPath := pagePath(MARKDOWN_DIR, NOTFOUND_FILE, exts)
+	if _, err := os.Stat(notFoundPath); err == nil {
+		postsPaths = append(postsPaths, notFoundPath)
 	}
-
-	/* Parse posts and add to cfg struct */
-	var posts []Post
-	postsDir := filepath.Join(MARKDOWN_DIR, "posts")
-	postsFS := os.DirFS(postsDir)
-	postsFilenames, err := fs.Glob(postsFS, "*.md")
-	for _, name := range postsFilenames {
-		path := filepath.Join(postsDir, name)
-		post, err := parsePost(path)
+	for _, path := range postsPaths {
+		frontmatter, _, err := readPost(path)
 		if err != nil {
-			return fmt.Errorf("error rendering posts: %w", err)
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+			continue
+		}
+		/* Frontmatter starts on the line after the opening boundary */
+		if line, err := validateJSON(frontmatter, &Post{}); err != nil {
+			problems = append(problems, fmt.Sprintf("%s:%d: %s", path, line+1, err))
 		}
-
-		posts = append(posts, post)
 	}
-	cfg.Posts = posts
 
-	/* Parse tags and add to cfg struct */
-	var tags []Tag
-	tagsDir := filepath.Join(MARKDOWN_DIR, "tags")
-	tagsFS := os.DirFS(tagsDir)
-	tagsFilenames, err := fs.Glob(tagsFS, "*.json")
+	tagsPaths, err := filepath.Glob(filepath.Join(MARKDOWN_DIR, "tags", "*.json"))
 	if err != nil {
-		return fmt.Errorf("error finding tags metadata files: %w", err)
+		return nil, 0, fmt.Errorf("error finding tags: %w", err)
 	}
-	for _, name := range tagsFilenames {
-		path := filepath.Join(tagsDir, name)
+	for _, path := range tagsPaths {
 		metadata, err := read(path)
 		if err != nil {
-			return fmt.Errorf("error reading tags metadata: %w", err)
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+			continue
 		}
-
 		var tag Tag
-		if err = json.Unmarshal(metadata, &tag); err != nil {
-			return fmt.Errorf("error unmarshaling tags metadata: %w", err)
+		if line, err := validateJSON(metadata, &tag); err != nil {
+			problems = append(problems, fmt.Sprintf("%s:%d: %s", path, line, err))
+		}
+		for _, slug := range tag.Posts {
+			if _, err := os.Stat(pagePath(filepath.Join(MARKDOWN_DIR, "posts"), slug+".md", exts)); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: lists post %q, but there is no such post in %s", path, slug, filepath.Join(MARKDOWN_DIR, "posts")))
+			}
 		}
-		tags = append(tags, tag)
 	}
-	cfg.Tags = tags
 
-	/* First render special pages */
-	/* Index page is the homepage */
-	/* Blog page is the blog listings page which displays all posts */
-	for _, name := range specialFiles {
+	return problems, len(postsPaths) + len(tagsPaths), nil
+}
 
-		/* Parse special page as a post */
-		path := filepath.Join(MARKDOWN_DIR, name)
-		post, err := parsePost(path)
-		if err != nil {
-			return fmt.Errorf("error parsing special file %s: %w", post.RootName, err)
-		}
-		switch name {
-		case INDEX_FILE:
-			post.Layout = "default"
-		case BLOG_FILE:
-			post.Layout = "blog"
-		}
+/* Checks run by the lint command, each can be skipped with --skip */
+var lintChecks []string = []string{"title", "description", "images", "headings", "whitespace"}
 
-		/* Render post with an empty tag */
-		/* No tag as this is not a typical 'post' but a special page which is always rendered */
-		destDir := SITE_DIR
-		err = renderPostHTML(post, cfg, destDir)
-		if err != nil {
-			return fmt.Errorf("error rendering special pages: %w", err)
+/* An ATX heading e.g. "## Setup", the number of #s being its level */
+var headingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})(\s|$)`)
+
+/***********************
+* Checks posts and pages for common content issues which don't stop the site from generating:
+*
+* 1. title - no title in the frontmatter
+* 2. description - no description in the frontmatter
+* 3. images - images which don't exist, either in the assets folder or next to the post for relative paths
+* 4. headings - headings which skip a level e.g. an h4 right after an h2
+* 5. whitespace - trailing whitespace, except the two spaces markdown uses for a line break
+*
+* Problems are reported in the form <file>:<line>: <problem>, or <file>: <problem> when the line isn't known
+* skip lists checks to leave out
+************************/
+func lint(skip []string) error {
+	for _, check := range skip {
+		if !slices.Contains(lintChecks, check) {
+			return fmt.Errorf("unknown lint check %q, expected one of %s", check, strings.Join(lintChecks, ", "))
 		}
 	}
 
-	/* Render blog posts */
-	postsFilenames, err = fs.Glob(postsFS, "*.md")
-	for _, name := range postsFilenames {
-
-		/* Parse post */
-		path := filepath.Join(postsDir, name)
-		post, err := parsePost(path)
-		if err != nil {
-			return fmt.Errorf("error parsing blog post %s: %w", post.RootName, err)
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	exts := postExtensions(cfg)
+	paths, err := globPages(filepath.Join(MARKDOWN_DIR, "posts"), exts)
+	if err != nil {
+		return fmt.Errorf("error finding posts: %w", err)
+	}
+	for _, name := range append(slices.Clone(specialFiles), NOTFOUND_FILE) {
+		if path := pagePath(MARKDOWN_DIR, name, exts); isFile(path) {
+			paths = append(paths, path)
 		}
-		post.Layout = "post"
+	}
 
-		/* Render post */
-		destDir := filepath.Join(SITE_DIR, "blog")
-		err = renderPostHTML(post, cfg, destDir)
+	var problems []string
+	for _, path := range paths {
+		found, err := lintPost(path, cfg, skip)
 		if err != nil {
-			return fmt.Errorf("error rendering posts: %w", err)
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+			continue
 		}
+		problems = append(problems, found...)
 	}
 
-	/* Render tags pages */
-	for _, t := range cfg.Tags {
-		/* Each tag page is stored in tagged/<tag>/<tag_page>.html - first create this directory tree + file */
-		if err = os.MkdirAll(filepath.Join(SITE_DIR, "tagged", t.Slug), 0750); err != nil {
-			return fmt.Errorf("error creating docs/tagged/%s folder: %w", t.Slug, err)
-		}
-
-		/* Render tag HTML */
-		destDir := filepath.Join(SITE_DIR, "tagged", t.Slug)
-		err = renderTagsHTML(t, cfg, destDir)
-		if err != nil {
-			return fmt.Errorf("error rendering tags: %w", err)
-		}
+	for _, problem := range problems {
+		reportError("%s", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s)", len(problems))
 	}
 
+	success("no problems found in %d posts and pages", len(paths))
 	return nil
 }
 
-func copyDir(src, dst string) error {
-	/* Get source info */
-	srcInfo, err := os.Stat(src)
+/***********************
+* Returns the problems found in a post or page, see lint()
+* Lines are counted from the top of the file, frontmatter included
+************************/
+func lintPost(path string, cfg Config, skip []string) (problems []string, err error) {
+	post, err := parsePost(path)
 	if err != nil {
-		return fmt.Errorf("error getting source info: %w", err)
+		return nil, err
 	}
-
-	/* Create destination directory with same permissions */
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		return fmt.Errorf("error creating destination directory: %w", err)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	/* Number of lines before the markdown i.e. the frontmatter and its boundaries */
+	offset := bytes.Count(raw[:len(raw)-len(post.Markdown)], []byte("\n"))
+	lines := strings.Split(string(post.Markdown), "\n")
+	/* line is 0 when it isn't known */
+	report := func(line int, format string, args ...any) {
+		if line == 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+			return
+		}
+		problems = append(problems, fmt.Sprintf("%s:%d: %s", path, line, fmt.Sprintf(format, args...)))
+	}
+	/* Line of a key in the frontmatter, whichever its format - 0 if the key isn't there */
+	frontmatter := strings.Split(string(raw[:len(raw)-len(post.Markdown)]), "\n")
+	keyLine := func(key string) int {
+		i := slices.IndexFunc(frontmatter, func(l string) bool {
+			l = strings.TrimSpace(l)
+			return strings.HasPrefix(l, `"`+key+`"`) || strings.HasPrefix(l, key+":") || strings.HasPrefix(l, key+" =") || strings.HasPrefix(l, key+"=")
+		})
+		return i + 1
 	}
 
-	/* Read source directory */
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return fmt.Errorf("error reading source directory: %w", err)
+	if !slices.Contains(skip, "title") && strings.TrimSpace(post.Title) == "" {
+		report(keyLine("title"), "no title")
+	}
+	if !slices.Contains(skip, "description") && strings.TrimSpace(post.Description) == "" {
+		report(keyLine("description"), "no description")
 	}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+	if !slices.Contains(skip, "images") {
+		doc, err := parseMarkdown(post, cfg)
+		if err != nil {
+			return nil, err
+		}
+		assetsDir := filepath.Join(cmp.Or(cfg.ContentDir, MARKDOWN_DIR), ASSETS_DIR)
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			image, ok := node.(*ast.Image)
+			if !ok || !entering {
+				return ast.GoToNext
+			}
+			dest := string(image.Destination)
+			/* Images on other sites aren't checked, relative ones are looked up next to the post */
+			var file string
+			if asset, ok := assetPath(dest, cfg); ok {
+				file = filepath.Join(assetsDir, filepath.FromSlash(asset))
+			} else if u, err := url.Parse(dest); err == nil && u.Scheme == "" && u.Host == "" && u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+				file = filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path))
+			} else {
+				return ast.GoToNext
+			}
+			if isFile(file) {
+				return ast.GoToNext
+			}
+			/* The AST doesn't keep positions, so the image is reported on the first line referencing it, if any */
+			/* e.g. ![a](dest), ![a](<dest>) or [a]: dest - so that images/a.png doesn't match ../assets/images/a.png */
+			line := 0
+			if i := slices.IndexFunc(lines, func(l string) bool {
+				return strings.Contains(l, "("+dest) || strings.Contains(l, "<"+dest) || strings.Contains(l, ": "+dest)
+			}); i != -1 {
+				line = offset + i + 1
+			}
+			report(line, "image %s not found at %s", dest, file)
+			return ast.GoToNext
+		})
+	}
 
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
+	/* Headings and whitespace are checked line by line, leaving out fenced code blocks */
+	inFence, lastLevel := false, 0
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !slices.Contains(skip, "whitespace") {
+			trailing := line[len(strings.TrimRight(line, " \t")):]
+			if trailing != "" && trailing != "  " {
+				report(offset+i+1, "trailing whitespace")
 			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
+		}
+		if inFence || slices.Contains(skip, "headings") {
+			continue
+		}
+		if match := headingRegex.FindStringSubmatch(line); match != nil {
+			level := len(match[1])
+			if lastLevel > 0 && level > lastLevel+1 {
+				report(offset+i+1, "heading skips from h%d to h%d", lastLevel, level)
 			}
+			lastLevel = level
 		}
 	}
 
-	return nil
+	return problems, nil
 }
 
-func copyFile(src, dst string) error {
-	sourceContent, err := os.ReadFile(src)
-	if err != nil {
-		return fmt.Errorf("error reading source file: %w", err)
+/***********************
+* Returns the path within the assets folder an image/link refers to e.g. "images/a.png" for /assets/images/a.png
+* Returns false for anything outside the assets folder, such as images on other sites or relative paths
+************************/
+func assetPath(dest string, cfg Config) (string, bool) {
+	if cfg.URL != "" {
+		dest = strings.TrimPrefix(dest, cfg.URL)
+	}
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return "", false
 	}
+	asset, found := strings.CutPrefix(path.Clean(u.Path), "/"+cfg.AssetsDir()+"/")
+	return asset, found
+}
 
-	return os.WriteFile(dst, sourceContent, 0644)
+/* Whether path exists and isn't a directory */
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
 }
 
 /***********************
-* Serves static site generated using the 'generate' command
-* The site is expected
+* Checks everything needed to generate the site and prints a checklist, one line per check:
 *
-* 1. Deletes old static site directory and creates a fresh one
-* 2. Creates a 'Config' struct that contains both config + content (posts, tags) for the website
-* 3. Render special pages i.e. homepage and blog listings page
+* 1. The config file (config.json, config.yaml or config.toml) exists and is valid
+* 2. The content directories and special pages created by init exist
+* 3. Every post, page and tag parses - see validate()
+* 4. Every tag used by a post exists
+* 5. No two posts resolve to the same page
+* 6. Every snippet included by a post or page exists - see expandIncludes()
+* 7. The site directory can be written to
 *
+* Every check runs even if an earlier one fails, so that all problems are reported at once
 ************************/
-func serveStaticSite(port int) error {
-	fileServer := http.FileServer(http.Dir("./docs"))
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-
-		requestPath := r.URL.Path
+func doctor() error {
+	checks := []struct {
+		name string
+		run  func() []string
+	}{
+		{"config file exists and is valid", doctorConfig},
+		{"content directories exist", doctorDirs},
+		{"all posts, pages and tags parse", doctorContent},
+		{"all tags used by posts exist", doctorTags},
+		{"no duplicate posts", doctorDuplicates},
+		{"all included snippets exist", doctorIncludes},
+		{fmt.Sprintf("site directory '%s' is writable", outputDir()), doctorSiteDir},
+	}
 
-		/* blog.html must be distinguished from the blog directory which contains posts */
-		if requestPath == "/blog" || requestPath == "/blog/" {
-			http.ServeFile(w, r, fmt.Sprintf("./%s/blog.html", SITE_DIR))
-			return
+	failed := 0
+	for _, check := range checks {
+		problems := check.run()
+		if len(problems) == 0 {
+			fmt.Printf("%s   %s\n", colorize(os.Stdout, COLOR_GREEN, "[ok]"), check.name)
+			continue
 		}
-
-		/* Check if the path maps to a file with .html (e.g., `/blog/<postname>.html`) */
-		htmlPath := SITE_DIR + requestPath + ".html"
-		if _, err := os.Stat(htmlPath); err == nil {
-			http.ServeFile(w, r, htmlPath)
-			return
+		failed++
+		fmt.Printf("%s %s\n", colorize(os.Stdout, COLOR_RED, "[fail]"), check.name)
+		for _, problem := range problems {
+			fmt.Printf("         %s\n", problem)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+func doctorConfig() []string {
+	path := configFile()
+	raw, err := read(path)
+	if err != nil {
+		return []string{fmt.Sprintf("%s, run 'ez-ssg init' first", err)}
+	}
+	if filepath.Ext(path) != ".json" {
+		/* Lines of the converted JSON wouldn't match the lines of the file, so they aren't reported */
+		if raw, err = configToJSON(path, raw); err != nil {
+			return []string{fmt.Sprintf("%s: %s", path, err)}
+		}
+		if _, err := validateJSON(raw, &Config{}); err != nil {
+			return []string{fmt.Sprintf("%s: %s", path, err)}
+		}
+		return nil
+	}
+	if line, err := validateJSON(raw, &Config{}); err != nil {
+		return []string{fmt.Sprintf("%s:%d: %s", path, line, err)}
+	}
+	return nil
+}
+
+func doctorDirs() []string {
+	return missingContent(MARKDOWN_DIR, contentExtensions())
+}
+
+/***********************
+* Returns a problem for each content directory or special page 'ez-ssg init' creates which is missing from contentDir
+************************/
+func missingContent(contentDir string, exts []string) []string {
+	var problems []string
+	for _, dir := range []string{"posts", "tags", ASSETS_DIR} {
+		path := filepath.Join(contentDir, dir)
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("directory %s is missing, run 'ez-ssg init' first", path))
+		}
+	}
+	for _, name := range specialFiles {
+		path := pagePath(contentDir, name, exts)
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Sprintf("page %s is missing, run 'ez-ssg init' first", path))
+		}
+	}
+	return problems
+}
+
+func doctorContent() []string {
+	problems, _, err := validateContent()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return problems
+}
+
+func doctorTags() []string {
+	postsPaths, err := globPages(filepath.Join(MARKDOWN_DIR, "posts"), contentExtensions())
+	if err != nil {
+		return []string{fmt.Sprintf("error finding posts: %s", err)}
+	}
+
+	var problems []string
+	for _, path := range postsPaths {
+		/* Posts which don't parse are reported by doctorContent() */
+		frontmatter, _, err := readPost(path)
+		if err != nil {
+			continue
+		}
+		var post Post
+		if err := json.Unmarshal(frontmatter, &post); err != nil {
+			continue
+		}
+		for _, tag := range post.Tags {
+			if _, err := os.Stat(filepath.Join(MARKDOWN_DIR, "tags", fmt.Sprintf("%s.json", strings.ToLower(tag)))); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: tag %s does not exist, create it using the tag command", path, tag))
+			}
+		}
+	}
+	return problems
+}
+
+func doctorDuplicates() []string {
+	cfg, _ := loadConfig()
+	postsPaths, err := globPages(filepath.Join(MARKDOWN_DIR, "posts"), postExtensions(cfg))
+	if err != nil {
+		return []string{fmt.Sprintf("error finding posts: %s", err)}
+	}
+	if err := checkDuplicatePosts(postsPaths, cfg.Languages); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+func doctorIncludes() []string {
+	paths, err := globPages(filepath.Join(MARKDOWN_DIR, "posts"), contentExtensions())
+	if err != nil {
+		return []string{fmt.Sprintf("error finding posts: %s", err)}
+	}
+	for _, name := range append(slices.Clone(specialFiles), NOTFOUND_FILE) {
+		if path := pagePath(MARKDOWN_DIR, name, contentExtensions()); isFile(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	var problems []string
+	for _, path := range paths {
+		/* Posts which don't parse are reported by doctorContent() */
+		_, markdown, err := readPost(path)
+		if err != nil {
+			continue
+		}
+		if _, err := expandIncludes(markdown, filepath.Join(MARKDOWN_DIR, INCLUDES_DIR), nil); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+		}
+	}
+	return problems
+}
+
+func doctorSiteDir() []string {
+	/* generate creates the site directory if it doesn't exist yet, so its parent must be writable instead */
+	dir := outputDir()
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".ez-ssg-doctor-")
+	if err != nil {
+		return []string{fmt.Sprintf("cannot write to %s: %s", dir, err)}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+/***********************
+* Strictly unmarshals JSON into v, rejecting unknown fields
+* On failure, also returns the line of data (starting from 1) where the problem was found
+************************/
+func validateJSON(data []byte, v any) (line int, err error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return 1, errors.New("no metadata found")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(v)
+	if err == nil {
+		return 0, nil
+	}
+
+	/* Find the offset in data where the problem is */
+	offset := int(decoder.InputOffset())
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = int(syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		offset = int(typeErr.Offset)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		if i := bytes.Index(data, []byte(field)); i != -1 {
+			offset = i
+		}
+	}
+	offset = min(offset, len(data))
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1, err
+}
+
+/***********************
+* Checks that metadata which was written to a file reads back exactly as it was written
+* Catches marshaling edge cases which would otherwise only surface when generating the site
+************************/
+func verifyRoundTrip(written []byte, readBack []byte, v any) error {
+	if err := json.Unmarshal(readBack, v); err != nil {
+		return fmt.Errorf("error unmarshaling metadata: %w", err)
+	}
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling metadata: %w", err)
+	}
+	if !bytes.Equal(raw, written) {
+		return errors.New("metadata read back does not match what was written")
+	}
+	return nil
+}
+
+/***********************
+* Migrates posts from a directory of Jekyll/Hugo markdown files into the 'markdown/posts' folder.
+* The posts are expected to have YAML frontmatter between '---' lines.
+*
+* The following frontmatter fields are mapped to the post's frontmatter:
+* 1. title (falls back to the filename)
+* 2. date (falls back to the date in Jekyll style filenames e.g. 2024-01-15-my-post.md)
+* 3. tags + categories (merged into tags)
+* 4. draft (Jekyll's 'published: false' also marks a draft)
+* 5. description
+*
+* Every other field is reported as unmapped. Existing posts are never overwritten.
+************************/
+func migrate(srcDir string) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %w", srcDir, err)
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".md" && ext != ".markdown") {
+			continue
+		}
+
+		srcPath := filepath.Join(srcDir, entry.Name())
+		raw, err := read(srcPath)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", srcPath, err)
+		}
+		frontmatter, body := splitYAMLFrontmatter(raw)
+
+		fields := map[string]any{}
+		if err := yaml.Unmarshal(frontmatter, &fields); err != nil {
+			return fmt.Errorf("error parsing YAML frontmatter of %s: %w", srcPath, err)
+		}
+
+		/* Jekyll filenames are prefixed with the date of the post */
+		name := strings.TrimSuffix(entry.Name(), ext)
+		var filenameDate time.Time
+		if len(name) > 11 {
+			if t, err := time.Parse("2006-01-02", name[:10]); err == nil && name[10] == '-' {
+				filenameDate = t
+				name = name[11:]
+			}
+		}
+
+		post, unmapped, err := migratePostFields(fields)
+		if err != nil {
+			return fmt.Errorf("error migrating %s: %w", srcPath, err)
+		}
+		if post.Title == "" {
+			post.Title = strings.ReplaceAll(name, "-", " ")
+		}
+		if post.Date == "" && !filenameDate.IsZero() {
+			post.Date = formatDate(filenameDate)
+		}
+
+		destPath := filepath.Join(MARKDOWN_DIR, "posts", name+".md")
+		if _, err := os.Stat(destPath); err == nil {
+			return fmt.Errorf("error migrating %s: %s already exists", srcPath, destPath)
+		}
+
+		rawMetadata, err := json.MarshalIndent(post, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling post metadata to json: %w", err)
+		}
+		if err := writePost(destPath, rawMetadata, body); err != nil {
+			return fmt.Errorf("error creating post file %s: %w", destPath, err)
+		}
+
+		logger.Printf("migrated %s -> %s", srcPath, destPath)
+		if len(unmapped) > 0 {
+			logger.Printf("  unmapped fields: %s", strings.Join(unmapped, ", "))
+		}
+	}
+
+	return nil
+}
+
+/***********************
+* Maps Jekyll/Hugo frontmatter fields to a post
+* Returns the sorted names of fields which could not be mapped
+************************/
+func migratePostFields(fields map[string]any) (post Post, unmapped []string, err error) {
+	post.Tags = []string{}
+
+	/* Sorted for a deterministic order of tags */
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value := fields[key]
+		switch key {
+		case "title":
+			post.Title = fmt.Sprint(value)
+		case "description":
+			post.Description = fmt.Sprint(value)
+		case "date":
+			t, err := parseMigratedDate(value)
+			if err != nil {
+				return post, nil, err
+			}
+			post.Date = formatDate(t)
+		case "tags", "categories":
+			for _, tag := range yamlStrings(value) {
+				tag = strings.ToLower(tag)
+				if !slices.Contains(post.Tags, tag) {
+					post.Tags = append(post.Tags, tag)
+				}
+			}
+		case "draft":
+			draft, _ := value.(bool)
+			post.Draft = post.Draft || draft
+		case "published":
+			published, ok := value.(bool)
+			post.Draft = post.Draft || (ok && !published)
+		default:
+			unmapped = append(unmapped, key)
+		}
+	}
+	return post, unmapped, nil
+}
+
+/***********************
+* Dates may be YAML timestamps or strings in one of the formats used by Jekyll/Hugo
+************************/
+func parseMigratedDate(value any) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+
+	layouts := []string{time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, fmt.Sprint(value)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+/***********************
+* Tags/categories are either a YAML list or a space separated string
+************************/
+func yamlStrings(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		var strs []string
+		for _, item := range v {
+			strs = append(strs, fmt.Sprint(item))
+		}
+		return strs
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
+
+/***********************
+* Splits a file into its YAML frontmatter (between '---' lines at the top of the file) and content
+* If the file has no frontmatter, everything is content
+************************/
+func splitYAMLFrontmatter(raw []byte) (frontmatter []byte, content []byte) {
+	raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+	if !bytes.HasPrefix(raw, []byte("---\n")) && !bytes.HasPrefix(raw, []byte("---\r\n")) {
+		return nil, raw
+	}
+
+	rest := raw[bytes.IndexByte(raw, '\n')+1:]
+	for offset := 0; offset < len(rest); {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		if end == -1 {
+			end = len(rest) - offset
+		} else {
+			end += 1
+		}
+		line := rest[offset : offset+end]
+		if string(bytes.TrimRight(line, "\r\n")) == "---" {
+			return rest[:offset], rest[offset+end:]
+		}
+		offset += end
+	}
+
+	return nil, raw
+}
+
+/***********************
+* Parses the config file
+************************/
+func loadConfig() (Config, error) {
+	var cfg Config
+
+	path := configFile()
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("error opening config file: %w", err)
+	}
+	defer f.Close()
+
+	cfgRaw, err := io.ReadAll(f)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if cfgRaw, err = configToJSON(path, cfgRaw); err != nil {
+		return cfg, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(cfgRaw, &cfg); err != nil {
+		return cfg, fmt.Errorf("error unmarshaling config file: %w", err)
+	}
+	return cfg, nil
+}
+
+/***********************
+* Returns the config file of the site - config.json unless only a YAML/TOML config exists
+************************/
+func configFile() string {
+	for _, name := range configFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return CONFIG_FILE
+}
+
+/***********************
+* Converts a YAML/TOML config to JSON, so that every format uses the same field names as config.json
+* A JSON config is returned as it is
+************************/
+func configToJSON(path string, raw []byte) ([]byte, error) {
+	var fields map[string]any
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+	default:
+		return raw, nil
+	}
+	return json.Marshal(fields)
+}
+
+/***********************
+* Converts JSON to block style YAML, keeping the order of fields
+************************/
+func jsonToYAML(raw []byte) ([]byte, error) {
+	/* JSON is valid YAML - it only has to be restyled */
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return nil, err
+	}
+	var restyle func(n *yaml.Node)
+	restyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			restyle(child)
+		}
+	}
+	restyle(&node)
+	return yaml.Marshal(&node)
+}
+
+/***********************
+* Converts JSON to TOML - TOML has no null, so null fields are left out
+************************/
+func jsonToTOML(raw []byte) ([]byte, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	var clean func(v any) any
+	clean = func(v any) any {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, value := range v {
+				if value == nil {
+					delete(v, key)
+					continue
+				}
+				v[key] = clean(value)
+			}
+		case []any:
+			for i := range v {
+				v[i] = clean(v[i])
+			}
+		case float64:
+			/* JSON numbers are floats, keep whole numbers such as years integers */
+			if v == float64(int64(v)) {
+				return int64(v)
+			}
+		}
+		return v
+	}
+	clean(fields)
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/***********************
+* Parses the posts and tags in contentDir (usually 'markdown') into the config - everything generate needs before rendering
+* Posts are only parsed, not yet converted to HTML
+************************/
+func loadSite(cfg Config, contentDir string) (Site, error) {
+	if !slices.Contains([]string{"", "ltr", "rtl", "auto"}, cfg.TextDirection) {
+		return Site{}, fmt.Errorf("invalid text_direction %q in config file: must be ltr, rtl or auto", cfg.TextDirection)
+	}
+
+	/* Order navigation by weight and make internal nav links absolute */
+	slices.SortStableFunc(cfg.Nav, func(a, b NavItem) int {
+		return a.Weight - b.Weight
+	})
+	for i, item := range cfg.Nav {
+		if strings.HasPrefix(item.URL, "/") {
+			cfg.Nav[i].URL = cfg.URL + item.URL
+		}
+	}
+
+	/* Parse posts and add to cfg struct */
+	/* Drafts are kept aside - they are never listed or linked to */
+	/* Posts are the built-in section, the only one with translations and drafts which can be shared */
+	var posts []Post
+	siteLang := cmp.Or(cfg.Language, "en")
+	published, drafts, err := parseSection(filepath.Join(contentDir, "posts"), postExtensions(cfg), cfg.Languages)
+	if err != nil {
+		return Site{}, err
+	}
+	for _, posts := range [][]Post{published, drafts} {
+		if err := resolveCovers(posts, cfg, contentDir); err != nil {
+			return Site{}, err
+		}
+	}
+	for _, post := range published {
+		/* Only configured languages count, so that e.g. "Intro_to_Node.js.md" is not taken as a translation */
+		if !slices.Contains(cfg.Languages, post.Lang) {
+			post.Lang = siteLang
+		}
+		post.Permalink = postPermalink(cfg, post.RootName)
+		if post.Lang != siteLang {
+			post.Permalink = cfg.URL + "/" + post.Lang + cfg.Paths.Blog + "/" + post.RootName
+		}
+
+		posts = append(posts, post)
+	}
+	posts, translations := linkTranslations(posts, siteLang)
+	cfg.Posts = sortPosts(posts)
+
+	/* Parse the pages of other sections - their drafts are never rendered */
+	for i, section := range cfg.Sections {
+		if err := checkSection(section); err != nil {
+			return Site{}, err
+		}
+		pages, _, err := parseSection(filepath.Join(contentDir, section.Dir), postExtensions(cfg), nil)
+		if err != nil {
+			return Site{}, err
+		}
+		for j := range pages {
+			pages[j].Permalink = cfg.URL + section.Path + "/" + pages[j].RootName
+		}
+		if err := resolveCovers(pages, cfg, contentDir); err != nil {
+			return Site{}, err
+		}
+		cfg.Sections[i].Pages = pages
+	}
+
+	/* Parse tags and add to cfg struct */
+	/* A malformed tag file is skipped rather than failing the whole site, it is up to the caller to report it */
+	var tags []Tag
+	var tagErrors []error
+	tagsDir := filepath.Join(contentDir, "tags")
+	tagsFS := os.DirFS(tagsDir)
+	tagsFilenames, err := fs.Glob(tagsFS, "*.json")
+	if err != nil {
+		return Site{}, fmt.Errorf("error finding tags metadata files: %w", err)
+	}
+	for _, name := range tagsFilenames {
+		path := filepath.Join(tagsDir, name)
+		metadata, err := read(path)
+		if err != nil {
+			tagErrors = append(tagErrors, fmt.Errorf("error reading tags metadata %s: %w", path, err))
+			continue
+		}
+
+		var tag Tag
+		if err = json.Unmarshal(metadata, &tag); err != nil {
+			tagErrors = append(tagErrors, fmt.Errorf("error unmarshaling tags metadata %s: %w", path, err))
+			continue
+		}
+		tag.Permalink = tagPermalink(cfg, tag.Slug)
+		for _, post := range cfg.Posts {
+			if post.ContainsTag(tag.Slug) {
+				tag.Count++
+			}
+		}
+		tags = append(tags, tag)
+	}
+	cfg.Tags = tags
+	if err := checkTagPosts(cfg.Tags, slices.Concat(cfg.Posts, translations, drafts)); err != nil {
+		return Site{}, err
+	}
+	linkTagNeighbours(cfg.Posts, cfg.Tags)
+	for _, posts := range [][]Post{cfg.Posts, translations, drafts} {
+		resolveTags(posts, cfg.Tags)
+	}
+	for _, section := range cfg.Sections {
+		resolveTags(section.Pages, cfg.Tags)
+	}
+
+	return Site{Config: cfg, Translations: translations, Drafts: drafts, TagErrors: tagErrors}, nil
+}
+
+/***********************
+* The site for templates, with pinned posts listed first - the posts of the config keep their order
+************************/
+func newSiteData(cfg Config) SiteData {
+	cfg.Posts = pinPosts(slices.Clone(cfg.Posts))
+	ver, _ := versionInfo()
+	return SiteData{Config: cfg, Version: ver}
+}
+
+/***********************
+* Sorts posts newest first, posts without a date last - posts with the same date keep their order
+************************/
+func sortPosts(posts []Post) []Post {
+	slices.SortStableFunc(posts, func(a, b Post) int {
+		return b.DateTime.Compare(a.DateTime)
+	})
+	return posts
+}
+
+/***********************
+* Moves pinned posts to the start of posts, newest first - the other posts keep their order
+************************/
+func pinPosts(posts []Post) []Post {
+	slices.SortStableFunc(posts, func(a, b Post) int {
+		if a.Pinned != b.Pinned {
+			if a.Pinned {
+				return -1
+			}
+			return 1
+		}
+		if !a.Pinned {
+			return 0
+		}
+		return b.DateTime.Compare(a.DateTime)
+	})
+	return posts
+}
+
+/***********************
+* Parses all pages (*.md, or the configured extensions) in the folder of a section, keeping drafts apart
+* Pages which would end up with the same name are an error - pages in different languages only don't clash if they are translations i.e. in languages
+************************/
+func parseSection(dir string, exts []string, languages []string) (pages []Post, drafts []Post, err error) {
+	paths, err := globPages(dir, exts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding pages in %s: %w", dir, err)
+	}
+	if err := checkDuplicatePosts(paths, languages); err != nil {
+		return nil, nil, err
+	}
+	for _, path := range paths {
+		page, err := parsePost(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error rendering posts: %w", err)
+		}
+		if page.Draft {
+			drafts = append(drafts, page)
+			continue
+		}
+		pages = append(pages, page)
+	}
+	return pages, drafts, nil
+}
+
+/***********************
+* Checks that a section in the config can be generated without clashing with the rest of the site
+************************/
+func checkSection(section Section) error {
+	if section.Dir == "" || slices.Contains([]string{"posts", "tags", ASSETS_DIR}, section.Dir) || strings.ContainsAny(section.Dir, `/\`) {
+		return fmt.Errorf("invalid section dir %q: must be a folder in %s other than posts, tags and assets", section.Dir, MARKDOWN_DIR)
+	}
+	if !strings.HasPrefix(section.Path, "/") || strings.HasSuffix(section.Path, "/") || slices.Contains([]string{"/blog", "/tagged", "/tags", "/assets", "/_drafts"}, section.Path) {
+		return fmt.Errorf("invalid path %q of section %s: must start with '/', not end with '/' and not be used by the rest of the site", section.Path, section.Dir)
+	}
+	if _, err := fs.Stat(layoutsEFS, fmt.Sprintf("layouts/%s.html", cmp.Or(section.Layout, "post"))); err != nil {
+		return fmt.Errorf("unknown layout %q of section %s", section.Layout, section.Dir)
+	}
+	return nil
+}
+
+/***********************
+* Writes the parsed site as JSON - the config along with the metadata of all posts (including translations and drafts) and tags
+* The markdown and HTML of posts are left out, as well as the draft secret
+************************/
+func exportSite(w io.Writer) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	site, err := loadSite(cfg, MARKDOWN_DIR)
+	if err != nil {
+		return err
+	}
+	for _, err := range site.TagErrors {
+		warn("skipped tag: %s", err)
+	}
+
+	cfg = site.Config
+	cfg.DraftSecret = ""
+	cfg.Posts = slices.Concat(cfg.Posts, site.Translations, site.Drafts)
+	for i := range cfg.Posts {
+		cfg.Posts[i].Markdown, cfg.Posts[i].HTML = nil, nil
+	}
+
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling site to json: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(raw))
+	return err
+}
+
+/***********************
+* Generates static site using data in the content folder: 'markdown'
+*
+* 1. Creates the static site directory if needed
+* 2. Creates a 'Config' struct that contains both config + content (posts, tags) for the website
+* 3. Render special pages i.e. homepage and blog listings page
+* 4. Removes the files of the old site which weren't generated again
+*
+* Files whose content didn't change are left untouched, so deploy tools comparing modification times don't upload them again
+* When pruning, the site is generated into a temporary directory and synced into the site directory instead - see pruneStaticSite()
+* Either way, a site directory which doesn't look like a generated site is left alone - see checkSiteDir()
+* The pre_build and post_build hooks run around all of it, with the site directory it ends up in - except on a dry run
+************************/
+func generateStaticSite(opts GenerateOptions) error {
+	if err := checkSiteDir(opts.SiteDir, opts.Force); err != nil {
+		return err
+	}
+	/* Checked before the site directory is touched, as e.g. running generate without init is a common mistake */
+	if _, err := os.Stat(MARKDOWN_DIR); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("content directory %s/ not found - run 'ez-ssg init' to create it, or run generate from your site's directory", MARKDOWN_DIR)
+	}
+	if problems := missingContent(MARKDOWN_DIR, contentExtensions()); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if opts.BaseURL != "" {
+		cfg.URL = opts.BaseURL
+	}
+
+	/* A dry run mustn't change anything, and hooks could do anything e.g. deploy the site */
+	hooks := cmp.Or(cfg.Hooks, &Hooks{})
+	if opts.DryRun {
+		hooks = &Hooks{}
+	}
+	if err := runHook("pre_build", hooks.PreBuild, opts); err != nil {
+		return err
+	}
+	if opts.Prune {
+		err = pruneStaticSite(opts, cfg)
+	} else {
+		err = writeStaticSite(opts, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	return runHook("post_build", hooks.PostBuild, opts)
+}
+
+/***********************
+* Generates the site into opts.SiteDir, removing the files of the old site which weren't generated again
+* Unlike generateStaticSite(), nothing is checked beforehand and no hooks are run
+************************/
+func writeStaticSite(opts GenerateOptions, cfg Config) error {
+	if err := os.MkdirAll(opts.SiteDir, 0750); err != nil {
+		return fmt.Errorf("error creating %s/ folder: %w", opts.SiteDir, err)
+	}
+	fsys := recordWriteFS{WriteFS: dirWriteFS(opts.SiteDir), written: map[string]bool{}}
+	if err := generateTo(fsys, cfg, MARKDOWN_DIR, opts); err != nil {
+		return err
+	}
+	if err := resetStaticSite(opts.SiteDir, fsys.written); err != nil {
+		return fmt.Errorf("error resetting site directory: %w", err)
+	}
+	return nil
+}
+
+/***********************
+* Runs a hook command through the shell, streaming its output - a command exiting with an error fails generate
+* The command can find the site directory and environment in EZ_SSG_SITE_DIR and EZ_SSG_ENV
+************************/
+func runHook(name string, command string, opts GenerateOptions) error {
+	if command == "" {
+		return nil
+	}
+	logger.Printf("running %s hook: %s", name, command)
+
+	var cmd *osexec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = osexec.Command("cmd", "/C", command)
+	} else {
+		cmd = osexec.Command("sh", "-c", command)
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "EZ_SSG_SITE_DIR="+opts.SiteDir, "EZ_SSG_ENV="+cmp.Or(opts.Env, ENV_PRODUCTION))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook %q failed: %w", name, command, err)
+	}
+	return nil
+}
+
+/***********************
+* Generates the static site from the content in contentDir (usually 'markdown') into fsys
+* Nothing is written to disk unless fsys writes to disk, so this can be tested and benchmarked in memory
+* Only the Drafts, Strict, Env and Progress options apply, the others are about the site directory
+************************/
+func generateTo(fsys WriteFS, cfg Config, contentDir string, opts GenerateOptions) error {
+	/* Posts are rendered concurrently, see forEach() */
+	/* Everything written is recorded, so that aliases can't replace it - under the lock, as maps aren't safe for concurrent use */
+	written := map[string]bool{}
+	fsys = lockedWriteFS{mu: &sync.Mutex{}, fsys: recordWriteFS{WriteFS: fsys, written: written}}
+	warned := warnings.Load()
+
+	/* The site is generated at the root of fsys */
+	siteDir := "."
+	if err := fsys.MkdirAll(filepath.Join(siteDir, "blog"), 0750); err != nil {
+		return fmt.Errorf("error creating %s/blog folder: %w", siteDir, err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(siteDir, "tagged"), 0750); err != nil {
+		return fmt.Errorf("error creating %s/tagged folder: %w", siteDir, err)
+	}
+	if err := fsys.WriteFile(filepath.Join(siteDir, SITE_MARKER), []byte("Generated by ez-ssg, this directory is replaced every time the site is generated.\n"), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", SITE_MARKER, err)
+	}
+	/* GitHub Pages runs Jekyll on the site otherwise, which drops files and folders starting with '_' e.g. _drafts */
+	if cfg.WritesNoJekyll() {
+		if err := fsys.WriteFile(filepath.Join(siteDir, ".nojekyll"), nil, 0644); err != nil {
+			return fmt.Errorf("error writing .nojekyll: %w", err)
+		}
+	}
+
+	/* Copy default assets and the 'markdown/assets' folder into site directory */
+	if !filepath.IsLocal(filepath.FromSlash(cfg.AssetsDir())) {
+		return fmt.Errorf("assets path %q must be a path within the site e.g. \"/static\"", cfg.Paths.Assets)
+	}
+	sourceAssetsPath := filepath.Join(contentDir, ASSETS_DIR)
+	targetAssetsPath := filepath.Join(siteDir, filepath.FromSlash(cfg.AssetsDir()))
+	if err := copyAssets(fsys, sourceAssetsPath, targetAssetsPath, cfg.UsesEmbeddedAssets()); err != nil {
+		return err
+	}
+
+	/* This config struct contains both config + content (posts, tags) */
+	/* Think of this as a master struct */
+	cfg.ContentDir = contentDir
+	site, err := loadSite(cfg, contentDir)
+	if err != nil {
+		return err
+	}
+	if opts.Strict && len(site.TagErrors) > 0 {
+		return errors.Join(site.TagErrors...)
+	}
+	cfg, translations, drafts := site.Config, site.Translations, site.Drafts
+	siteLang := cmp.Or(cfg.Language, "en")
+
+	/* Markdown is only converted now that all posts and tags are known, so that internal links can be resolved */
+	/* Posts are converted before rendering any page since the blog listings page shows their summaries */
+	for _, posts := range [][]Post{cfg.Posts, translations} {
+		err := forEach(len(posts), opts.Jobs, func(i int) error {
+			if err := renderMarkdown(&posts[i], cfg); err != nil {
+				return fmt.Errorf("error parsing blog post %s: %w", posts[i].RootName, err)
+			}
+			if len(bytes.TrimSpace(posts[i].HTML)) == 0 {
+				warn("post %s has no content, only frontmatter", posts[i].RootName)
+			}
+			if err := summarizePost(&posts[i], cfg); err != nil {
+				return fmt.Errorf("error parsing summary of blog post %s: %w", posts[i].RootName, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	data := newSiteData(cfg)
+	if data.Icons, err = loadIcons(contentDir); err != nil {
+		return err
+	}
+	if data.BuildTime, err = buildTime(); err != nil {
+		return err
+	}
+	data.Env = cmp.Or(opts.Env, ENV_PRODUCTION)
+
+	/* Generate favicons of all sizes from a single image */
+	if cfg.Favicon != "" {
+		if err := generateFavicons(fsys, filepath.Join(sourceAssetsPath, cfg.Favicon), targetAssetsPath); err != nil {
+			return fmt.Errorf("error generating favicons: %w", err)
+		}
+	}
+
+	/* First render special pages */
+	/* Index page is the homepage */
+	/* Blog page is the blog listings page which displays all posts */
+	for _, name := range specialFiles {
+
+		/* Parse special page as a post */
+		path := pagePath(contentDir, name, postExtensions(cfg))
+		post, err := parsePost(path)
+		if err != nil {
+			return fmt.Errorf("error parsing special file %s: %w", post.RootName, err)
+		}
+		if err := renderMarkdown(&post, cfg); err != nil {
+			return fmt.Errorf("error rendering special file %s: %w", post.RootName, err)
+		}
+		var pageType string
+		switch name {
+		case INDEX_FILE:
+			post.Layout = "default"
+			pageType = PAGE_HOME
+		case BLOG_FILE:
+			/* The blog listings page is rendered like the listing page of any other section */
+			post.Layout = cmp.Or(post.Layout, "blog")
+			if err := renderListing(fsys, post, data, PAGE_BLOG, filepath.Join(siteDir, "blog")); err != nil {
+				return fmt.Errorf("error rendering special pages: %w", err)
+			}
+			continue
+		}
+
+		/* Render post with an empty tag */
+		/* No tag as this is not a typical 'post' but a special page which is always rendered */
+		destDir := siteDir
+		err = renderPostHTML(fsys, post, data, pageType, destDir)
+		if err != nil {
+			return fmt.Errorf("error rendering special pages: %w", err)
+		}
+	}
+
+	/* Render the 404 page - markdown/404.md is optional */
+	if err := renderNotFoundPage(fsys, data, contentDir, siteDir); err != nil {
+		return fmt.Errorf("error rendering 404 page: %w", err)
+	}
+
+	/* Render blog posts */
+	posts := slices.Concat(cfg.Posts, translations)
+	bar := newProgress(opts.Progress, "posts rendered", len(posts))
+	defer bar.stop()
+	err = forEach(len(posts), opts.Jobs, func(i int) error {
+		post := posts[i]
+		post.Layout = "post"
+
+		/* Render post - posts in other languages than the site's go to <lang>/blog */
+		destDir := filepath.Join(siteDir, "blog")
+		if post.Lang != siteLang {
+			destDir = filepath.Join(siteDir, post.Lang, "blog")
+			if err := fsys.MkdirAll(destDir, 0750); err != nil {
+				return fmt.Errorf("error creating %s folder: %w", destDir, err)
+			}
+		}
+		if err := renderPostHTML(fsys, post, data, PAGE_POST, destDir); err != nil {
+			return fmt.Errorf("error rendering posts: %w", err)
+		}
+		bar.step(filepath.Join(destDir, pageFilename(cfg, post.RootName, PAGE_POST)))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	/* Render other sections - each one has a listing page at its path and its pages under it */
+	for _, section := range cfg.Sections {
+		if err := renderSection(fsys, section, data, contentDir, siteDir); err != nil {
+			return fmt.Errorf("error rendering section %s: %w", section.Dir, err)
+		}
+	}
+
+	/* Render drafts to unlisted URLs so that they can be shared before publishing */
+	if opts.Drafts {
+		if err := renderDrafts(fsys, drafts, data, siteDir); err != nil {
+			return err
+		}
+	}
+
+	/* Render tags pages */
+	for _, t := range cfg.Tags {
+		/* Each tag page is stored in tagged/<tag>/<tag_page>.html - first create this directory tree + file */
+		if err = fsys.MkdirAll(filepath.Join(siteDir, "tagged", t.Slug), 0750); err != nil {
+			return fmt.Errorf("error creating %s folder: %w", filepath.Join(siteDir, "tagged", t.Slug), err)
+		}
+
+		/* Render tag HTML */
+		destDir := filepath.Join(siteDir, "tagged", t.Slug)
+		err = renderTagsHTML(fsys, t, data, destDir)
+		if err != nil {
+			return fmt.Errorf("error rendering tags: %w", err)
+		}
+	}
+
+	/* Render the page listing every tag, at /tags like the listing page of a section */
+	if cfg.HasTagsPage() {
+		listing := Post{Title: "Tags", RootName: "tags", Layout: "tags", Permalink: cfg.URL + "/tags"}
+		if err := renderListing(fsys, listing, data, PAGE_TAGS, filepath.Join(siteDir, "tags")); err != nil {
+			return fmt.Errorf("error rendering tags page: %w", err)
+		}
+	}
+
+	/* Render the RSS feeds of the site and of each tag */
+	if err := renderFeed(fsys, cfg.Posts, data, "", filepath.Join(siteDir, "feed.xml")); err != nil {
+		return fmt.Errorf("error rendering feed: %w", err)
+	}
+	for _, t := range cfg.Tags {
+		var tagged []Post
+		for _, post := range cfg.Posts {
+			if post.ContainsTag(t.Slug) {
+				tagged = append(tagged, post)
+			}
+		}
+		if err := renderFeed(fsys, tagged, data, t.DisplayName(), filepath.Join(siteDir, "tagged", t.Slug, "feed.xml")); err != nil {
+			return fmt.Errorf("error rendering feed of tag %s: %w", t.Slug, err)
+		}
+	}
+
+	if err := renderSitemap(fsys, posts, data, siteDir); err != nil {
+		return fmt.Errorf("error rendering sitemap: %w", err)
+	}
+
+	/* Skipped tag files are reported last so that they aren't lost among the other output */
+	for _, err := range site.TagErrors {
+		warn("skipped tag: %s", err)
+	}
+
+	/* Redirect the old paths of renamed posts, once everything they mustn't replace is generated */
+	if err := writeAliases(fsys, posts, cfg, siteDir, written); err != nil {
+		return err
+	}
+
+	/* Extra files are written last, so they can replace any generated file */
+	if err := writeExtraFiles(fsys, cfg.ExtraFiles, contentDir, siteDir); err != nil {
+		return err
+	}
+
+	if n := warnings.Load() - warned; opts.Strict && n > 0 {
+		return fmt.Errorf("warned %d times while generating, failing because of --strict", n)
+	}
+	return nil
+}
+
+/***********************
+* Generates the site into a temporary directory, then syncs it into the site directory:
+*
+* 1. Generated files which are new or changed are copied over, unchanged files are left untouched
+* 2. Files in the site directory which were not generated are removed, unless they match a keep_files pattern
+*
+* Unlike a regular generate, files added to the site directory by hand can be kept around
+* With DryRun, the changes are only printed
+************************/
+func pruneStaticSite(opts GenerateOptions, cfg Config) error {
+	tmpDir, err := os.MkdirTemp("", "ez-ssg-generate-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	generateOpts := opts
+	generateOpts.SiteDir = tmpDir
+	if err := writeStaticSite(generateOpts, cfg); err != nil {
+		return err
+	}
+
+	/* Copy over new and changed files */
+	generated := map[string]bool{}
+	err = filepath.WalkDir(tmpDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(tmpDir, path)
+		if err != nil {
+			return err
+		}
+		generated[rel] = true
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(opts.SiteDir, rel)
+		if opts.DryRun {
+			if existing, err := os.ReadFile(dst); err != nil || !bytes.Equal(existing, content) {
+				fmt.Printf("would write %s\n", dst)
+			}
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+			return err
+		}
+		return writeIfChanged(dst, content)
+	})
+	if err != nil {
+		return fmt.Errorf("error copying generated site: %w", err)
+	}
+
+	/* Remove files which are no longer generated */
+	var orphaned []string
+	err = filepath.WalkDir(opts.SiteDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(opts.SiteDir, path)
+		if err != nil {
+			return err
+		}
+		if !generated[rel] && !keepFile(rel, cfg.KeepFiles) {
+			orphaned = append(orphaned, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error finding orphaned files: %w", err)
+	}
+	for _, path := range orphaned {
+		if opts.DryRun {
+			fmt.Printf("would remove %s\n", path)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing orphaned file: %w", err)
+		}
+		fmt.Printf("removed %s\n", path)
+	}
+
+	return nil
+}
+
+/***********************
+* Whether a file in the site directory (relative to it) matches one of the keep_files patterns
+* Patterns use filepath.Match syntax e.g. "CNAME" or ".well-known/*"
+************************/
+func keepFile(rel string, patterns []string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+/***********************
+* Walks the site directory and sums up the size of all files
+* Keeps track of the n largest files
+************************/
+func summarizeSite(siteDir string, n int) (SiteSummary, error) {
+	var summary SiteSummary
+	var files []FileSize
+	err := filepath.WalkDir(siteDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		summary.Files++
+		summary.Bytes += info.Size()
+		files = append(files, FileSize{Path: path, Bytes: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return summary, fmt.Errorf("error walking %s: %w", siteDir, err)
+	}
+
+	slices.SortStableFunc(files, func(a, b FileSize) int { return cmp.Compare(b.Bytes, a.Bytes) })
+	summary.Largest = files[:min(n, len(files))]
+	return summary, nil
+}
+
+/***********************
+* Prints the size of the generated site and its largest files, as JSON for scripts if asked to
+* Warns about GitHub Pages' limits - sites up to 1 GB, files up to 100 MB
+************************/
+func printSiteSummary(siteDir string, asJSON bool) error {
+	summary, err := summarizeSite(siteDir, 5)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range summary.Largest {
+		if f.Bytes > 100<<20 {
+			warn("%s is %s, GitHub Pages rejects files over 100 MB", f.Path, formatBytes(f.Bytes))
+		}
+	}
+	if summary.Bytes > 1<<30 {
+		warn("the site is %s, GitHub Pages sites may be at most 1 GB", formatBytes(summary.Bytes))
+	}
+
+	if asJSON {
+		raw, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling site summary to json: %w", err)
+		}
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	success("generated %d files, %s in total", summary.Files, formatBytes(summary.Bytes))
+	fmt.Println("largest files:")
+	for _, f := range summary.Largest {
+		fmt.Printf("  %-10s %s\n", formatBytes(f.Bytes), f.Path)
+	}
+	return nil
+}
+
+/***********************
+* Formats a size in bytes for humans e.g. "1.5 MB"
+************************/
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+/***********************
+* Resizes a square-ish source image (PNG, JPEG or GIF) into the standard favicon sizes and writes them as PNGs to destDir
+* Images which are not square are cropped to their center
+* The <link> tags for these files are in the head include
+************************/
+func generateFavicons(fsys WriteFS, src string, destDir string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening favicon source image: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("error decoding favicon source image %s: %w", src, err)
+	}
+
+	for name, size := range faviconSizes {
+		var out bytes.Buffer
+		if err := png.Encode(&out, resizeSquare(img, size)); err != nil {
+			return fmt.Errorf("error encoding favicon %s: %w", name, err)
+		}
+		if err := fsys.WriteFile(filepath.Join(destDir, name), out.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error creating favicon %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+/***********************
+* Crops an image to a centered square and resizes it to size x size pixels
+* Catmull-Rom keeps small icons smooth when shrinking a large logo
+************************/
+func resizeSquare(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	square := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Src, nil)
+	return dst
+}
+
+/***********************
+* Copies the assets of the site into targetDir
+*
+* 1. The default assets embedded in the binary i.e. style.css and favicon.ico - unless embedded is false,
+*    e.g. when the user's assets are a complete theme
+* 2. The user's assets from sourceDir (markdown/assets) - these win over the defaults,
+*    e.g. a markdown/assets/style.css replaces the default stylesheet
+*
+* A note is printed for every default which is replaced, as the defaults change along with ez-ssg
+************************/
+func copyAssets(fsys WriteFS, sourceDir, targetDir string, embedded bool) error {
+	if embedded {
+		defaults, err := fs.Sub(assetsEFS, ASSETS_DIR)
+		if err != nil {
+			return fmt.Errorf("error reading default assets: %w", err)
+		}
+		if err := copyToFS(fsys, defaults, targetDir); err != nil {
+			return fmt.Errorf("error copying default assets: %w", err)
+		}
+
+		err = filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(sourceDir, path)
+			if err != nil {
+				return err
+			}
+			if _, err := fs.Stat(defaults, filepath.ToSlash(rel)); err == nil {
+				/* Replacing a default is deliberate, so this is only a note which --strict doesn't fail on */
+				logger.Printf("note: %s replaces the default %s", path, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading assets directory: %w", err)
+		}
+	}
+
+	if err := copyToFS(fsys, os.DirFS(sourceDir), targetDir); err != nil {
+		return fmt.Errorf("error copying assets directory from markdown to site: %w", err)
+	}
+	return nil
+}
+
+/***********************
+* Copies all files of src into targetDir of fsys, overwriting existing files
+************************/
+func copyToFS(fsys WriteFS, src fs.FS, targetDir string) error {
+	return fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(targetDir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return fsys.MkdirAll(target, 0750)
+		}
+		content, err := fs.ReadFile(src, path)
+		if err != nil {
+			return err
+		}
+		return fsys.WriteFile(target, content, 0644)
+	})
+}
+
+/***********************
+* Serves a single file, answering HEAD and conditional requests (If-None-Match, If-Modified-Since) without a body when the file is unchanged
+* The ETag is derived from the modification time and size of the file, so regenerating a page changes it
+* The content type comes from the extension of the file (see contentType()) unless already set
+************************/
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		if ct := contentType(path); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+/***********************
+* Returns the content type of a file served locally from its extension, empty if unknown so that it is sniffed from the content instead
+************************/
+func contentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	return mime.TypeByExtension(ext)
+}
+
+/* Whether port can be listened on, 0 isn't accepted since it picks a random port */
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+/***********************
+* Parses a port passed as an argument e.g. 'ez-ssg serve 8080'
+************************/
+func parsePort(arg string) (int, error) {
+	port, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, err
+	}
+	if !validPort(port) {
+		return 0, fmt.Errorf("port %d out of range, expected 1 to 65535", port)
+	}
+	return port, nil
+}
+
+/***********************
+* Whether err is about the address being in use already
+* Windows reports it as WSAEADDRINUSE (10048), which doesn't match syscall.EADDRINUSE there
+************************/
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.Errno(10048))
+}
+
+/***********************
+* Serves static site generated using the 'generate' command
+* The site is expected
+*
+* 1. Deletes old static site directory and creates a fresh one
+* 2. Creates a 'Config' struct that contains both config + content (posts, tags) for the website
+* 3. Render special pages i.e. homepage and blog listings page
+*
+************************/
+func serveStaticSite(opts ServeOptions) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", siteHandler(opts))
+
+	var handler http.Handler = mux
+	if opts.Verbose {
+		handler = logRequests(mux)
+	}
+
+	/* Only reachable from this machine unless an address is given explicitly */
+	addr := opts.Addr
+	if addr == "" {
+		addr = fmt.Sprintf("127.0.0.1:%d", opts.Port)
+	}
+
+	/* Listen before serving so that the browser is only opened once the site is reachable */
+	listener, err := net.Listen("tcp", addr)
+	if isAddrInUse(err) {
+		return fmt.Errorf("%s is already in use, e.g. by another site being served - pass another port using --port", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+
+	url := listenURL(listener.Addr().(*net.TCPAddr))
+	logger.Printf("serving %s at %s", opts.Dir, url)
+	if opts.Open {
+		if err := openBrowser(url); err != nil {
+			logger.Printf("could not open browser, visit %s instead: %s", url, err)
+		}
+	}
+
+	return http.Serve(listener, handler)
+}
+
+/***********************
+* Serves the files of the site in opts.Dir the way a static host would e.g. /blog/my_post from blog/my_post.html
+* Anything which doesn't exist gets the generated 404 page
+************************/
+func siteHandler(opts ServeOptions) http.HandlerFunc {
+	fileServer := http.FileServer(http.Dir(opts.Dir))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		requestPath := r.URL.Path
+
+		if opts.NoCache {
+			w.Header().Set("Cache-Control", "no-store, must-revalidate")
+		}
+
+		/* Aliases of posts are redirected like a server in production would, rather than through their refresh page */
+		/* The aliases are read on every request so that regenerating the site while serving is picked up */
+		if target, ok := readAliases(opts.Dir)["/"+strings.Trim(requestPath, "/")]; ok {
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		/* Check if the path maps to a file with .html (e.g., `/blog/<postname>.html`) */
+		htmlPath := filepath.Join(opts.Dir, requestPath+".html")
+		if _, err := os.Stat(htmlPath); err == nil {
+			serveFile(w, r, htmlPath)
+			return
+		}
+
+		/* Pages generated without an extension are HTML too */
+		path := filepath.Join(opts.Dir, requestPath)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && filepath.Ext(path) == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			serveFile(w, r, path)
+			return
+		}
+
+		/* Any other file, or the index.html of a directory */
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				path = filepath.Join(path, "index.html")
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				serveFile(w, r, path)
+				return
+			}
+		}
+
+		/* Serve the generated 404 page for anything else which doesn't exist */
+		notFoundPath := filepath.Join(opts.Dir, "404.html")
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if page, err := os.ReadFile(notFoundPath); err == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write(page)
+				return
+			}
 		}
 
 		fileServer.ServeHTTP(w, r)
+	}
+}
+
+/***********************
+* Returns the alias -> path mapping written by generate into dir, empty if the site has no aliases
+************************/
+func readAliases(dir string) map[string]string {
+	aliases := map[string]string{}
+	if raw, err := os.ReadFile(filepath.Join(dir, ALIASES_FILE)); err == nil {
+		json.Unmarshal(raw, &aliases)
+	}
+	return aliases
+}
+
+/***********************
+* Returns the URL to visit a server listening on addr at
+* A server listening on all interfaces (e.g. 0.0.0.0:3000) or on the loopback address is visited through localhost
+************************/
+func listenURL(addr *net.TCPAddr) string {
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() || addr.IP.IsLoopback() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+/* Records the status code written by a handler */
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+/***********************
+* Logs the method, path and status of every request handled by next
+************************/
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logger.Printf("%s %s %d", r.Method, r.URL.Path, rec.status)
 	})
+}
+
+/***********************
+* Previews the static site without touching the site directory
+*
+* 1. Generates the static site into a temporary directory, pointing all links at localhost
+* 2. Serves the temporary directory and opens the homepage in the default browser
+* 3. Deletes the temporary directory when the server is stopped (e.g. using Ctrl+C)
+************************/
+func previewStaticSite(previewOpts PreviewOptions) error {
+	port := previewOpts.Port
+	dir, err := os.MkdirTemp("", "ez-ssg-preview-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary preview directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := GenerateOptions{
+		SiteDir: dir,
+		BaseURL: fmt.Sprintf("http://localhost:%d", port),
+		Drafts:  previewOpts.Drafts,
+		Env:     ENV_DEVELOPMENT,
+	}
+	if err := generateStaticSite(opts); err != nil {
+		return fmt.Errorf("error generating preview: %w", err)
+	}
 
-	http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	/* Serving only stops on interrupt, which skips deferred calls - clean up explicitly */
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		os.RemoveAll(dir)
+		os.Exit(0)
+	}()
 
-	return nil
+	return serveStaticSite(ServeOptions{Dir: dir, Port: port, Open: true, NoCache: true, Verbose: previewOpts.Verbose})
+}
+
+/***********************
+* Opens a URL in the default browser of the OS
+************************/
+func openBrowser(url string) error {
+	var cmd *osexec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = osexec.Command("open", url)
+	case "windows":
+		cmd = osexec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = osexec.Command("xdg-open", url)
+	}
+	return cmd.Start()
 }
 
 /***********************
@@ -613,14 +3445,18 @@ func serveStaticSite(port int) error {
 * - Layout template which is fully filled -> Final HTML page
 ************************/
 
-func renderPostHTML(post Post, cfg Config, destDir string) error {
+func renderPostHTML(fsys WriteFS, post Post, site SiteData, pageType string, destDir string) error {
+	cfg := site.Config
+
 	/* We have to execute includes template for each page */
 	/* Copy includes templates from embedded includesFS into memory */
 	includesFilenames, err := fs.Glob(includesEFS, "includes/*.html")
 	if err != nil {
 		return fmt.Errorf("error finding includes filenames: %s", err)
 	}
-	includes := template.Must(template.ParseFS(includesEFS, includesFilenames...))
+	includes := template.Must(template.New("includes").Funcs(templateFuncs(site)).ParseFS(includesEFS, includesFilenames...))
+	/* Fully rendered html for header, footer, etc - local to the page, as pages are rendered concurrently */
+	includesRender := map[string]template.HTML{}
 	for _, name := range includesFilenames {
 		root := strings.Split(name, "/")[1]
 		includesRender[root] = ""
@@ -629,8 +3465,11 @@ func renderPostHTML(post Post, cfg Config, destDir string) error {
 	/* Generate includes using page and site info*/
 	/* Hardcoding includes file names */
 	includesContent := IncludesContent{
-		Site: cfg,
-		Post: post,
+		Site:       site,
+		Post:       post,
+		PageType:   PageType(pageType),
+		CurrentURL: pageURL(cfg, post, pageType),
+		Year:       site.BuildTime.Year(),
 	}
 	for k := range includesRender {
 		b := bytes.Buffer{}
@@ -649,13 +3488,15 @@ func renderPostHTML(post Post, cfg Config, destDir string) error {
 
 	/* Generate layout using page content and includes info */
 	layoutContent := LayoutContent{
-		Content:  template.HTML(post.HTML),
-		Site:     cfg,
-		Post:     post,
-		Includes: includesRender,
+		Content:    template.HTML(post.HTML),
+		Site:       site,
+		Post:       post,
+		Includes:   includesRender,
+		PageType:   PageType(pageType),
+		CurrentURL: includesContent.CurrentURL,
 	}
 	layoutFilename := post.Layout
-	layoutTempl, err := template.ParseFS(layoutsEFS, fmt.Sprintf("layouts/%s.html", layoutFilename))
+	layoutTempl, err := template.New(layoutFilename+".html").Funcs(templateFuncs(site)).ParseFS(layoutsEFS, fmt.Sprintf("layouts/%s.html", layoutFilename))
 
 	if err != nil {
 		return fmt.Errorf("error parsing layout template file %s: %w", layoutFilename, err)
@@ -665,17 +3506,10 @@ func renderPostHTML(post Post, cfg Config, destDir string) error {
 	render := bytes.Buffer{}
 	layoutTempl.Execute(&render, layoutContent)
 
-	// f, err := os.Create(filepath.Join(destDir, fmt.Sprintf("%s", post.RootName)))
-	f, err := os.Create(filepath.Join(destDir, fmt.Sprintf("%s.html", post.RootName)))
-	if err != nil {
+	if err := fsys.WriteFile(filepath.Join(destDir, pageFilename(cfg, post.RootName, pageType)), render.Bytes(), 0644); err != nil {
 		return fmt.Errorf("error creating HTML file for %s: %w", post.RootName, err)
 	}
 
-	_, err = io.Copy(f, &render)
-	if err != nil {
-		return fmt.Errorf("error rendering HTML for %s: %w", post.RootName, err)
-	}
-
 	return nil
 }
 
@@ -684,7 +3518,8 @@ func renderPostHTML(post Post, cfg Config, destDir string) error {
 * Read the documentation for renderPostHTML(...) to understand the process
 ************************/
 
-func renderTagsHTML(tag Tag, cfg Config, destDir string) error {
+func renderTagsHTML(fsys WriteFS, tag Tag, site SiteData, destDir string) error {
+	cfg := site.Config
 
 	/* We have to execute includes template for each page */
 	/* Copy includes templates from embedded includesFS into memory */
@@ -692,70 +3527,506 @@ func renderTagsHTML(tag Tag, cfg Config, destDir string) error {
 	if err != nil {
 		return fmt.Errorf("error finding includes filenames: %s", err)
 	}
-	includes := template.Must(template.ParseFS(includesEFS, includesFilenames...))
+	includes := template.Must(template.New("includes").Funcs(templateFuncs(site)).ParseFS(includesEFS, includesFilenames...))
+	/* Fully rendered html for header, footer, etc - local to the page, as pages are rendered concurrently */
+	includesRender := map[string]template.HTML{}
 	for _, name := range includesFilenames {
 		root := strings.Split(name, "/")[1]
 		includesRender[root] = ""
 	}
 
-	/* Generate includes using page and site info*/
-	/* Hardcoding includes file names */
-	includesContent := IncludesContent{
-		Site: cfg,
-		Post: Post{Layout: "tagged", RootName: tag.Slug},
+	/* Generate includes using page and site info*/
+	/* Hardcoding includes file names */
+	includesContent := IncludesContent{
+		Site:     site,
+		Post:     Post{Layout: "tagged", RootName: tag.Slug},
+		PageType: PAGE_TAG,
+		Year:     site.BuildTime.Year(),
+	}
+	for k := range includesRender {
+		b := bytes.Buffer{}
+		includes.ExecuteTemplate(&b, k, includesContent)
+		switch k {
+		case "header.html":
+			includesRender[INCLUDES_HEADER] = template.HTML((b.String()))
+		case "footer.html":
+			includesRender[INCLUDES_FOOTER] = template.HTML((b.String()))
+		case "head.html":
+			includesRender[INCLUDES_HEAD] = template.HTML((b.String()))
+		case "footer-post.html":
+			includesRender[INCLUDES_FOOTERPOST] = template.HTML((b.String()))
+		}
+	}
+
+	var tagAsPost Post = Post{Layout: "tagged", RootName: tag.Slug}
+	layoutFilename := "tagged"
+	layoutTempl, err := template.New(layoutFilename+".html").Funcs(templateFuncs(site)).ParseFS(layoutsEFS, fmt.Sprintf("layouts/%s.html", layoutFilename))
+
+	/* The first page is tagged/<tag>/<tag>, the others tagged/<tag>/page/<n> */
+	pages := paginate(tagPosts(tag, site.Posts), cfg.PostsPerPage)
+	pageLink := func(n int) string {
+		if n == 1 {
+			return tag.Permalink
+		}
+		return fmt.Sprintf("%s/tagged/%s/page/%d", cfg.URL, tag.Slug, n)
+	}
+	for i, posts := range pages {
+		dir, name := destDir, tagAsPost.RootName
+		if i > 0 {
+			dir, name = filepath.Join(destDir, "page"), strconv.Itoa(i+1)
+			if err := fsys.MkdirAll(dir, 0750); err != nil {
+				return fmt.Errorf("error creating %s folder: %w", dir, err)
+			}
+		}
+
+		/* Generate layout using includes info + tag info - tag layout technically has no markdown content as such unlike a post */
+		layoutContent := LayoutContent{
+			Site:       site,
+			Post:       tagAsPost,
+			Includes:   includesRender,
+			Tag:        tag,
+			Posts:      posts,
+			Pagination: newPagination(i+1, len(pages), pageLink),
+			PageType:   PAGE_TAG,
+			CurrentURL: pageLink(i + 1),
+		}
+
+		/* Create final HTML file */
+		render := bytes.Buffer{}
+		layoutTempl.Execute(&render, layoutContent)
+
+		if err := fsys.WriteFile(filepath.Join(dir, pageFilename(cfg, name, PAGE_TAG)), render.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error creating HTML file for %s: %w", tagAsPost.RootName, err)
+		}
+	}
+
+	return nil
+}
+
+/* Position of a page among the pages a listing is split into, with the URLs of its neighbours */
+type Pagination struct {
+	Page    int    /* Starting from 1 */
+	Pages   int    /* Total number of pages, 1 if the listing isn't split */
+	PrevURL string /* Empty on the first page */
+	NextURL string /* Empty on the last page */
+}
+
+/***********************
+* Splits posts into pages of perPage posts each, in order
+* All posts are on a single page if perPage is 0, and there is always at least one page even without posts
+************************/
+func paginate(posts []Post, perPage int) [][]Post {
+	if perPage <= 0 || len(posts) <= perPage {
+		return [][]Post{posts}
+	}
+	return slices.Collect(slices.Chunk(posts, perPage))
+}
+
+/* Returns the pagination of page n out of pages, pageLink returns the URL of a page by its number */
+func newPagination(n int, pages int, pageLink func(int) string) Pagination {
+	pagination := Pagination{Page: n, Pages: pages}
+	if n > 1 {
+		pagination.PrevURL = pageLink(n - 1)
+	}
+	if n < pages {
+		pagination.NextURL = pageLink(n + 1)
+	}
+	return pagination
+}
+
+/***********************
+* Renders the page shown for missing pages to 404.html, which hosts like GitHub Pages pick up automatically
+* The page is read from markdown/404.md if it exists, otherwise a default page linking back home is rendered
+************************/
+func renderNotFoundPage(fsys WriteFS, site SiteData, contentDir string, siteDir string) error {
+	cfg := site.Config
+	post := Post{
+		Title:    "Page not found",
+		Markdown: []byte("# Page not found\n\nThe page you are looking for does not exist. [Go back home](" + cfg.URL + "/)."),
+	}
+	path := pagePath(contentDir, NOTFOUND_FILE, postExtensions(cfg))
+	if _, err := os.Stat(path); err == nil {
+		if post, err = parsePost(path); err != nil {
+			return err
+		}
+	}
+	post.RootName = "404"
+	post.Layout = "default"
+
+	if err := renderMarkdown(&post, cfg); err != nil {
+		return err
+	}
+	return renderPostHTML(fsys, post, site, PAGE_NOT_FOUND, siteDir)
+}
+
+/***********************
+* Renders the pages of a section under its path, e.g. /projects/my_project, and its listing page at its path
+* The content of the listing page is read from markdown/<dir>.md if it exists, like blog.md for posts
+************************/
+func renderSection(fsys WriteFS, section Section, site SiteData, contentDir string, siteDir string) error {
+	cfg := site.Config
+	pagesDir := filepath.Join(siteDir, filepath.FromSlash(strings.TrimPrefix(section.Path, "/")))
+	if err := fsys.MkdirAll(pagesDir, 0750); err != nil {
+		return fmt.Errorf("error creating %s folder: %w", pagesDir, err)
+	}
+
+	for _, page := range section.Pages {
+		if err := renderMarkdown(&page, cfg); err != nil {
+			return fmt.Errorf("error parsing page %s: %w", page.RootName, err)
+		}
+		page.Layout = cmp.Or(page.Layout, section.Layout, "post")
+		if err := renderPostHTML(fsys, page, site, PAGE_POST, pagesDir); err != nil {
+			return err
+		}
+	}
+
+	listing := Post{Title: cmp.Or(section.Title, section.Dir)}
+	path := pagePath(contentDir, section.Dir+".md", postExtensions(cfg))
+	if _, err := os.Stat(path); err == nil {
+		if listing, err = parsePost(path); err != nil {
+			return fmt.Errorf("error parsing %s: %w", path, err)
+		}
+	}
+	if err := renderMarkdown(&listing, cfg); err != nil {
+		return fmt.Errorf("error rendering %s: %w", path, err)
+	}
+	listing.Layout = cmp.Or(listing.Layout, "section")
+	listing.RootName = filepath.Base(pagesDir)
+	listing.Permalink = cfg.URL + section.Path
+	listing.Pages = section.Pages
+	return renderListing(fsys, listing, site, PAGE_SECTION, pagesDir)
+}
+
+/***********************
+* Renders the listing page of a section both next to the section's directory and as its index.html
+* e.g. blog.html and blog/index.html, so that /blog, /blog.html and /blog/ all work on any host
+* The layout can be changed in the listing page's frontmatter e.g. "layout": "section" in blog.md
+************************/
+func renderListing(fsys WriteFS, listing Post, site SiteData, pageType string, dir string) error {
+	if _, err := fs.Stat(layoutsEFS, fmt.Sprintf("layouts/%s.html", listing.Layout)); err != nil {
+		return fmt.Errorf("layout %q of listing page %s does not exist", listing.Layout, listing.RootName)
+	}
+	if err := renderPostHTML(fsys, listing, site, pageType, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("error creating %s folder: %w", dir, err)
+	}
+	listing.RootName = "index"
+	return renderPostHTML(fsys, listing, site, pageType, dir)
+}
+
+/* RSS 2.0 feed, see https://www.rssboard.org/rss-specification */
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+/***********************
+* Renders sitemap.xml into siteDir, listing the absolute URL of every indexable page:
+*
+* 1. The homepage and blog listing page
+* 2. Posts (including translations) and the pages of sections, dated by their date where it can be parsed
+* 3. The listing page of each section and the page listing every tag
+* 4. The page of each tag, even one without posts since it is generated anyway
+*
+* Posts which opt out using in_sitemap or noindex are left out, as are drafts and the 404 page since they aren't linked from the site
+************************/
+func renderSitemap(fsys WriteFS, posts []Post, site SiteData, siteDir string) error {
+	cfg := site.Config
+	urls := []sitemapURL{{Loc: pageURL(cfg, Post{}, PAGE_HOME)}, {Loc: pageURL(cfg, Post{}, PAGE_BLOG)}}
+	addPages := func(pages []Post) {
+		for _, page := range pages {
+			if !page.IncludedInSitemap() {
+				continue
+			}
+			entry := sitemapURL{Loc: page.Permalink}
+			if !page.DateTime.IsZero() {
+				entry.LastMod = page.DateTime.Format("2006-01-02")
+			}
+			urls = append(urls, entry)
+		}
+	}
+
+	addPages(posts)
+	for _, section := range cfg.Sections {
+		urls = append(urls, sitemapURL{Loc: cfg.URL + section.Path})
+		addPages(section.Pages)
+	}
+	if cfg.HasTagsPage() {
+		urls = append(urls, sitemapURL{Loc: cfg.URL + "/tags"})
+	}
+	for _, tag := range cfg.Tags {
+		urls = append(urls, sitemapURL{Loc: tagPermalink(cfg, tag.Slug)})
+	}
+
+	raw, err := xml.MarshalIndent(sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: urls}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling sitemap: %w", err)
+	}
+	return fsys.WriteFile(filepath.Join(siteDir, "sitemap.xml"), append(append([]byte(xml.Header), raw...), '\n'), 0644)
+}
+
+/***********************
+* Renders an RSS feed of posts to path, newest first, leaving out posts which opt out of feeds
+* Posts without a date, or with one which can't be parsed, are listed last without a pubDate
+* The feed is titled after the site, followed by tagName for the feed of a single tag
+* Items carry the whole post if feed_full_content is set, otherwise its summary - falling back to its description and excerpt
+************************/
+func renderFeed(fsys WriteFS, posts []Post, site SiteData, tagName string, path string) error {
+	cfg := site.Config
+	channel := rssChannel{
+		Title:         cfg.Title,
+		Link:          cfg.URL,
+		Description:   cfg.Description,
+		Language:      cfg.Language,
+		LastBuildDate: site.BuildTime.Format(time.RFC1123Z),
+	}
+	if tagName != "" {
+		channel.Title = fmt.Sprintf("%s - %s", cfg.Title, tagName)
+	}
+
+	/* Undated posts have the zero time, so they sort last */
+	posts = sortPosts(slices.Clone(posts))
+	for _, post := range posts {
+		if !post.IncludedInFeed() {
+			continue
+		}
+		item := rssItem{Title: post.Title, Link: post.Permalink, GUID: post.Permalink}
+		if !post.DateTime.IsZero() {
+			item.PubDate = post.DateTime.Format(time.RFC1123Z)
+		}
+		switch {
+		case cfg.FeedFull:
+			item.Description = string(post.HTML)
+		/* Summaries which are only the excerpt make way for the description */
+		case post.SummaryText != "", bytes.Contains(post.Markdown, []byte(excerptSep(cfg))):
+			item.Description = string(post.Summary)
+		default:
+			item.Description = cmp.Or(post.Description, post.Excerpt)
+		}
+		for _, tag := range post.ResolvedTags {
+			item.Categories = append(item.Categories, tag.DisplayName())
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	raw, err := xml.MarshalIndent(rssFeed{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling feed: %w", err)
+	}
+	return fsys.WriteFile(path, append(append([]byte(xml.Header), raw...), '\n'), 0644)
+}
+
+/***********************
+* Calls fn for 0..n-1, running at most jobs calls at once (GOMAXPROCS if jobs is 0)
+* Every call is made even if some fail, their errors are returned joined in order so that the result doesn't depend on scheduling
+************************/
+func forEach(n int, jobs int, fn func(i int) error) error {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, n)
+	limit := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i := range n {
+		limit <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-limit; wg.Done() }()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+/***********************
+* Writes the extra files of the config into siteDir as they are, from their content or their source file in contentDir
+* Paths must stay within the site directory
+************************/
+func writeExtraFiles(fsys WriteFS, files []ExtraFile, contentDir string, siteDir string) error {
+	for _, file := range files {
+		if !filepath.IsLocal(file.Path) {
+			return fmt.Errorf("extra file %q must be a relative path within the site directory", file.Path)
+		}
+		if (file.Content == "") == (file.Source == "") {
+			return fmt.Errorf("extra file %s must have either content or source", file.Path)
+		}
+
+		content := []byte(file.Content)
+		if file.Source != "" {
+			var err error
+			if content, err = os.ReadFile(filepath.Join(contentDir, file.Source)); err != nil {
+				return fmt.Errorf("error reading source of extra file %s: %w", file.Path, err)
+			}
+		}
+
+		path := filepath.Join(siteDir, file.Path)
+		if err := fsys.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return fmt.Errorf("error creating folder of extra file %s: %w", file.Path, err)
+		}
+		if err := fsys.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("error writing extra file %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+/***********************
+* Renders each draft to _drafts/<hash> where the hash is computed from the draft's root name and the draft secret
+* The resulting URLs are not linked from anywhere, so a single draft can be shared without exposing the others
+* The URL of each draft is printed
+************************/
+func renderDrafts(fsys WriteFS, drafts []Post, site SiteData, siteDir string) error {
+	cfg := site.Config
+	secret := cfg.DraftSecret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("error generating draft secret: %w", err)
+		}
+		secret = hex.EncodeToString(b)
+		if len(drafts) > 0 {
+			warn("draft_secret is not set in %s, draft URLs will change every time the site is generated", configFile())
+		}
+	}
+
+	destDir := filepath.Join(siteDir, "_drafts")
+	if err := fsys.MkdirAll(destDir, 0750); err != nil {
+		return fmt.Errorf("error creating %s folder: %w", destDir, err)
 	}
-	for k := range includesRender {
-		b := bytes.Buffer{}
-		includes.ExecuteTemplate(&b, k, includesContent)
-		switch k {
-		case "header.html":
-			includesRender[INCLUDES_HEADER] = template.HTML((b.String()))
-		case "footer.html":
-			includesRender[INCLUDES_FOOTER] = template.HTML((b.String()))
-		case "head.html":
-			includesRender[INCLUDES_HEAD] = template.HTML((b.String()))
-		case "footer-post.html":
-			includesRender[INCLUDES_FOOTERPOST] = template.HTML((b.String()))
+
+	for _, draft := range drafts {
+		if err := renderMarkdown(&draft, cfg); err != nil {
+			return fmt.Errorf("error parsing draft %s: %w", draft.RootName, err)
 		}
-	}
+		draft.Layout = "post"
 
-	var tagAsPost Post = Post{Layout: "tagged", RootName: tag.Slug}
+		sum := sha256.Sum256([]byte(draft.RootName + secret))
+		name := draft.RootName
+		draft.RootName = hex.EncodeToString(sum[:16])
+		draft.Permalink = cfg.URL + "/_drafts/" + draft.RootName
 
-	/* Generate layout using includes info + tag info - tag layout technically has no markdown content as such unlike a post */
-	layoutContent := LayoutContent{
-		Site:     cfg,
-		Post:     tagAsPost,
-		Includes: includesRender,
-		Tag:      tag,
+		if err := renderPostHTML(fsys, draft, site, PAGE_POST, destDir); err != nil {
+			return fmt.Errorf("error rendering drafts: %w", err)
+		}
+		fmt.Printf("draft %s: %s\n", name, draft.Permalink)
 	}
-	layoutFilename := "tagged"
-	layoutTempl, err := template.ParseFS(layoutsEFS, fmt.Sprintf("layouts/%s.html", layoutFilename))
 
-	/* Create final HTML file */
-	render := bytes.Buffer{}
-	layoutTempl.Execute(&render, layoutContent)
+	return nil
+}
 
-	// f, err := os.Create(filepath.Join(destDir, fmt.Sprintf("%s", tagAsPost.RootName)))
-	f, err := os.Create(filepath.Join(destDir, fmt.Sprintf("%s.html", tagAsPost.RootName)))
+/***********************
+* Writes a page redirecting to the post at each of its aliases e.g. docs/blog/old_name/index.html for "/blog/old_name"
+* Static hosts can't redirect, so the page does it using <meta http-equiv="refresh">
+*
+* The alias -> path mapping is written to ALIASES_FILE as well, so that serve can answer with a real 301 instead
+* Aliases must be paths within the site, no two posts may share one and they can't replace anything already
+* generated i.e. in written, e.g. "/blog" or "/tagged/golang"
+************************/
+func writeAliases(fsys WriteFS, posts []Post, cfg Config, siteDir string, written map[string]bool) error {
+	tmpl, err := template.ParseFS(layoutsEFS, "layouts/alias.html")
 	if err != nil {
-		return fmt.Errorf("error creating HTML file for %s: %w", tagAsPost.RootName, err)
+		return fmt.Errorf("error parsing alias template: %w", err)
+	}
+
+	/* Every alias is checked before writing any, so that the folders of one alias don't count as generated for another */
+	aliases := map[string]string{}
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			rel := strings.Trim(alias, "/")
+			if !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return fmt.Errorf("alias %q of post %s must be a path within the site", alias, post.RootName)
+			}
+			if _, ok := aliases["/"+rel]; ok {
+				return fmt.Errorf("alias %q of post %s is used by another post", alias, post.RootName)
+			}
+			path := filepath.Join(siteDir, filepath.FromSlash(rel))
+			if written[path] || written[path+".html"] {
+				return fmt.Errorf("alias %q of post %s would replace a generated page", alias, post.RootName)
+			}
+			aliases["/"+rel] = cmp.Or(strings.TrimPrefix(post.Permalink, cfg.URL), "/")
+		}
+	}
+
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			dir := filepath.Join(siteDir, filepath.FromSlash(strings.Trim(alias, "/")))
+			if err := fsys.MkdirAll(dir, 0750); err != nil {
+				return fmt.Errorf("error creating %s folder: %w", dir, err)
+			}
+			var page bytes.Buffer
+			if err := tmpl.Execute(&page, post); err != nil {
+				return fmt.Errorf("error rendering alias %q of post %s: %w", alias, post.RootName, err)
+			}
+			if err := fsys.WriteFile(filepath.Join(dir, "index.html"), page.Bytes(), 0644); err != nil {
+				return fmt.Errorf("error writing alias %q of post %s: %w", alias, post.RootName, err)
+			}
+		}
 	}
 
-	_, err = io.Copy(f, &render)
+	if len(aliases) == 0 {
+		return nil
+	}
+	raw, err := json.MarshalIndent(aliases, "", "  ")
 	if err != nil {
-		return fmt.Errorf("error rendering HTML for %s: %w", tagAsPost.RootName, err)
+		return fmt.Errorf("error marshaling aliases: %w", err)
 	}
+	return fsys.WriteFile(filepath.Join(siteDir, ALIASES_FILE), raw, 0644)
+}
 
-	return nil
+/***********************
+* Returns the name of the HTML file a page is written to
+* Posts and tag pages are written without an extension if configured, for hosts which serve
+* clean URLs (/blog/my-post) from extension-less files. The homepage and blog listing page
+* always keep theirs - they must be found as index.html and can't clash with the blog/ directory.
+************************/
+func pageFilename(cfg Config, rootName string, pageType string) string {
+	if cfg.Extensionless && (pageType == PAGE_POST || pageType == PAGE_TAG) {
+		return rootName
+	}
+	return rootName + ".html"
 }
 
 /***********************
 * Takes a post path and returns a post struct
 *
 * 1. Reads raw post metadata (frontmatter) and markdown in the form of bytes
-* 2. Converts markdown to HTML
-* 3. Parses post title from the path
+* 2. Parses post title from the path
 * Returns all of the above in a post struct
+*
+* Markdown is converted to HTML separately using renderMarkdown(...) once the whole site is known
 ************************/
 func parsePost(path string) (post Post, err error) {
 	metadata, markdown, err := readPost(path)
@@ -769,12 +4040,227 @@ func parsePost(path string) (post Post, err error) {
 	}
 
 	post.Markdown = markdown
-	post.HTML = mdToHTML(markdown)
 	post.RootName = postRootName(path)
+	post.Lang = postLang(path)
+	post.SourcePath = filepath.ToSlash(path)
+	post.DateTime, _ = parseDateFlag(post.Date)
+	if info, err := os.Stat(path); err == nil {
+		post.ModTime = info.ModTime()
+	}
 
 	return post, nil
 }
 
+/***********************
+* Connects posts which are translations of one another i.e. have the same root name e.g. my_post.en.md and my_post.fr.md
+* Each post gets the list of all its language versions
+*
+* Only one version of each post is listed on the site - the one in the site's language if it exists
+* Returns the listed posts and the remaining translations separately
+************************/
+func linkTranslations(posts []Post, siteLang string) (listed []Post, translations []Post) {
+	versions := map[string][]Translation{}
+	for _, post := range posts {
+		slug := slugify(post.RootName)
+		versions[slug] = append(versions[slug], Translation{Lang: post.Lang, URL: post.Permalink})
+	}
+
+	for _, post := range posts {
+		slug := slugify(post.RootName)
+		if len(versions[slug]) == 1 {
+			listed = append(listed, post)
+			continue
+		}
+
+		post.Translations = slices.SortedFunc(slices.Values(versions[slug]), func(a, b Translation) int {
+			return strings.Compare(a.Lang, b.Lang)
+		})
+		hasSiteLang := slices.ContainsFunc(versions[slug], func(t Translation) bool { return t.Lang == siteLang })
+		/* Without a version in the site's language, the first version found is listed */
+		isListed := post.Lang == siteLang || (!hasSiteLang && versions[slug][0].Lang == post.Lang)
+		if isListed {
+			listed = append(listed, post)
+		} else {
+			translations = append(translations, post)
+		}
+	}
+
+	return listed, translations
+}
+
+/***********************
+* Returns the absolute URL of a post/tag page
+************************/
+func postPermalink(cfg Config, rootName string) string {
+	return cfg.URL + cfg.Paths.Blog + "/" + rootName
+}
+
+func tagPermalink(cfg Config, slug string) string {
+	return cfg.URL + "/tagged/" + slug + "/" + slug
+}
+
+/***********************
+* Returns the absolute URL a page is served at
+************************/
+func pageURL(cfg Config, post Post, pageType string) string {
+	switch pageType {
+	case PAGE_HOME:
+		return cfg.URL + "/"
+	case PAGE_BLOG:
+		return cfg.URL + cfg.Paths.Blog
+	case PAGE_TAG:
+		return tagPermalink(cfg, post.RootName)
+	case PAGE_NOT_FOUND:
+		return cfg.URL + "/404"
+	default:
+		/* Drafts are not at the usual post URL */
+		if post.Permalink != "" {
+			return post.Permalink
+		}
+		return postPermalink(cfg, post.RootName)
+	}
+}
+
+/***********************
+* Returns the class of the page's <body> - the page type e.g. "post" or "home", followed by the post's own body_class
+* The 404 page is "not-found" since a class can't start with a digit
+************************/
+func (c IncludesContent) BodyClass() string {
+	class := string(c.PageType)
+	if c.IsNotFound() {
+		class = "not-found"
+	}
+	return strings.TrimSpace(class + " " + c.Post.BodyClass)
+}
+
+/***********************
+* Used inside the header template to highlight the active navigation link
+* A link is active on the page it points to and, unless it points to the homepage, on the pages under it
+* e.g. the blog link is active on every post
+************************/
+func (c IncludesContent) IsActive(url string) bool {
+	url = strings.TrimSuffix(url, "/")
+	current := strings.TrimSuffix(c.CurrentURL, "/")
+	if url == current {
+		return true
+	}
+	return url != strings.TrimSuffix(c.Site.URL, "/") && strings.HasPrefix(current, url+"/")
+}
+
+/***********************
+* Sets the previous/next post within each tag of every post, so that readers can browse a topic in order
+* Posts are ordered by date - undated posts keep their relative order at the start
+************************/
+func linkTagNeighbours(posts []Post, tags []Tag) {
+	for _, tag := range tags {
+		var inTag []int
+		for i, post := range posts {
+			if post.ContainsTag(tag.Slug) {
+				inTag = append(inTag, i)
+			}
+		}
+		slices.SortStableFunc(inTag, func(a, b int) int {
+			dateA, dateB := posts[a].DateTime, posts[b].DateTime
+			return dateA.Compare(dateB)
+		})
+
+		for j, i := range inTag {
+			var neighbours TagNeighbours
+			if j > 0 {
+				prev := posts[inTag[j-1]]
+				neighbours.Prev = &PostRef{Title: prev.Title, URL: prev.Permalink}
+			}
+			if j < len(inTag)-1 {
+				next := posts[inTag[j+1]]
+				neighbours.Next = &PostRef{Title: next.Title, URL: next.Permalink}
+			}
+			if posts[i].InTag == nil {
+				posts[i].InTag = map[string]TagNeighbours{}
+			}
+			posts[i].InTag[tag.Slug] = neighbours
+		}
+	}
+}
+
+/***********************
+* Returns the posts listed on a tag's page - the tag's own list of posts first in its order, then the other posts of the tag
+* The other posts keep their order on the blog page
+************************/
+func tagPosts(tag Tag, posts []Post) []Post {
+	var listed []Post
+	for _, slug := range tag.Posts {
+		if i := slices.IndexFunc(posts, func(p Post) bool { return p.RootName == slug }); i >= 0 {
+			listed = append(listed, posts[i])
+		}
+	}
+	for _, post := range posts {
+		if post.ContainsTag(tag.Slug) && !slices.Contains(tag.Posts, post.RootName) {
+			listed = append(listed, post)
+		}
+	}
+	return listed
+}
+
+/***********************
+* Checks that every post listed by a tag exists, drafts included so that a listed draft appears once published
+************************/
+func checkTagPosts(tags []Tag, posts []Post) error {
+	for _, tag := range tags {
+		for _, slug := range tag.Posts {
+			if !slices.ContainsFunc(posts, func(p Post) bool { return p.RootName == slug }) {
+				return fmt.Errorf("tag %s lists post %q, but there is no such post in %s", tag.Slug, slug, filepath.Join(MARKDOWN_DIR, "posts"))
+			}
+		}
+	}
+	return nil
+}
+
+/***********************
+* Sets the URL and size of the cover image of every post which has one, read from the image in markdown/assets
+* A cover image which is missing or can't be decoded (PNG, JPEG or GIF) is an error
+************************/
+func resolveCovers(posts []Post, cfg Config, contentDir string) error {
+	for i, post := range posts {
+		if post.Cover == "" {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(post.Cover)) {
+			return fmt.Errorf("cover image %q of post %s must be a path within the assets folder", post.Cover, post.RootName)
+		}
+		path := filepath.Join(contentDir, ASSETS_DIR, filepath.FromSlash(post.Cover))
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error opening cover image of post %s: %w", post.RootName, err)
+		}
+		imgCfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("error reading size of cover image %s of post %s: %w", path, post.RootName, err)
+		}
+
+		posts[i].CoverURL = cfg.AssetsURL() + "/" + strings.TrimPrefix(post.Cover, "/")
+		posts[i].CoverWidth, posts[i].CoverHeight = imgCfg.Width, imgCfg.Height
+	}
+	return nil
+}
+
+/***********************
+* Sets the tags of every post to the full tags, so that layouts can show their names and link to them
+* A tag which was never created only has its slug, and no permalink since it has no page
+************************/
+func resolveTags(posts []Post, tags []Tag) {
+	for i := range posts {
+		posts[i].ResolvedTags = nil
+		for _, slug := range posts[i].Tags {
+			tag := Tag{Slug: slug}
+			if j := slices.IndexFunc(tags, func(t Tag) bool { return t.Slug == strings.ToLower(slug) }); j != -1 {
+				tag = tags[j]
+			}
+			posts[i].ResolvedTags = append(posts[i].ResolvedTags, tag)
+		}
+	}
+}
+
 /***********************
 * Returns the rootname from a post path
 * We are expecting the post to be of form: "<post_title>.md"
@@ -784,6 +4270,77 @@ func postRootName(path string) string {
 	return strings.Split(filename, ".")[0]
 }
 
+/***********************
+* Returns the language of a post from its path, if any
+* A translated post is of form: "<post_title>.<language>.md" e.g. "my_post.fr.md" or "my_post.pt-BR.md"
+************************/
+func postLang(path string) string {
+	_, filename := filepath.Split(path)
+	parts := strings.Split(strings.TrimSuffix(filename, filepath.Ext(filename)), ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	lang := parts[len(parts)-1]
+	if !langRegex.MatchString(lang) {
+		return ""
+	}
+	return lang
+}
+
+/***********************
+* Returns an error if two posts resolve to the same root name
+* Root names are slugified before comparing since e.g. "My Post.md" and "my_post.md"
+* end up as the same page on case-insensitive filesystems, silently overwriting one another
+*
+* Translations of a post have the same root name but are different pages. Like in loadSite(), only a suffix which is one of
+* languages makes a translation - e.g. "my_post.en.md" in an English site or "Intro_to_Node.js.md" are the site's language
+************************/
+func checkDuplicatePosts(paths []string, languages []string) error {
+	type page struct{ slug, lang string }
+	seen := map[page]string{}
+	for _, path := range paths {
+		key := page{slug: slugify(postRootName(path))}
+		if lang := postLang(path); slices.Contains(languages, lang) {
+			key.lang = lang
+		}
+		if other, exists := seen[key]; exists {
+			return fmt.Errorf("duplicate post %q: %s and %s resolve to the same page", key.slug, other, path)
+		}
+		seen[key] = path
+	}
+	return nil
+}
+
+/***********************
+* Normalizes a post name the same way createPost builds filenames, ignoring case
+* E.g. "My Post" -> "my_post"
+************************/
+func slugify(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+}
+
+/***********************
+* Reports a problem which does not stop the site from being generated
+************************/
+func warn(format string, args ...any) {
+	warnings.Add(1)
+	logger.Print(colorize(os.Stderr, COLOR_YELLOW, fmt.Sprintf("warning: "+format, args...)))
+}
+
+/***********************
+* Reports an error without stopping the command e.g. when only one of several posts can't be created
+************************/
+func reportError(format string, args ...any) {
+	logger.Print(colorize(os.Stderr, COLOR_RED, fmt.Sprintf(format, args...)))
+}
+
+/***********************
+* Reports that a command succeeded
+************************/
+func success(format string, args ...any) {
+	fmt.Println(colorize(os.Stdout, COLOR_GREEN, fmt.Sprintf(format, args...)))
+}
+
 /***********************
 * Simply reads a file
 ************************/
@@ -803,29 +4360,83 @@ func read(path string) ([]byte, error) {
 }
 
 /***********************
-* Used before generating static site
-*
-* 1. Deletes old site directory
-* 2. Creates fresh site directories and sub-directories
-* 3. Creates a sample assets folder with sample favicon and CSS
+* Guards against deleting the wrong directory e.g. if the site directory is misconfigured as the home directory
+* A missing or empty directory is fine, otherwise it must contain the marker file written by generate - unless forced
+* Sites generated before the marker existed are recognised by their homepage and blog listings page, generate then adds the marker
 ************************/
-func resetStaticSite() error {
-	if err := os.RemoveAll(SITE_DIR); err != nil {
-		return fmt.Errorf("error deleting old docs/ folder to create new one: %w", err)
+func checkSiteDir(siteDir string, force bool) error {
+	entries, err := os.ReadDir(siteDir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) || force {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s/ folder: %w", siteDir, err)
 	}
-	if err := os.MkdirAll(filepath.Join(SITE_DIR, "blog"), 0750); err != nil {
-		return fmt.Errorf("error creating docs/blog folder: %w", err)
+	if isFile(filepath.Join(siteDir, SITE_MARKER)) || (isFile(filepath.Join(siteDir, "index.html")) && isFile(filepath.Join(siteDir, "blog.html"))) {
+		return nil
 	}
-	if err := os.MkdirAll(filepath.Join(SITE_DIR, "tagged"), 0750); err != nil {
-		return fmt.Errorf("error creating docs/tagged folder: %w", err)
+	return fmt.Errorf("refusing to replace %s/: it isn't empty and has no %s file, so %w - move its files elsewhere, or generate with --force if it really is your site", siteDir, SITE_MARKER, errNotGeneratedSite)
+}
+
+/***********************
+* Used after generating static site
+*
+* 1. Deletes every file of the old site which wasn't written again (paths in written are relative to siteDir)
+* 2. Deletes the folders left empty, unless they were created again
+************************/
+func resetStaticSite(siteDir string, written map[string]bool) error {
+	var dirs []string
+	err := filepath.WalkDir(siteDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == siteDir {
+			return err
+		}
+		rel, err := filepath.Rel(siteDir, path)
+		if err != nil {
+			return err
+		}
+		if written[rel] {
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error deleting old file %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	/* Copy embedded assets to docs/assets instead of docs */
-	if err := os.CopyFS(SITE_DIR, assetsEFS); err != nil {
-		return fmt.Errorf("error copying docs/assets folder: %w", err)
+
+	/* Deepest folders first, so that a folder holding only empty folders is empty by the time it's reached */
+	for _, dir := range slices.Backward(dirs) {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return fmt.Errorf("error deleting old folder %s: %w", dir, err)
+			}
+		}
 	}
 	return nil
 }
 
+/***********************
+* Writes data to path unless the file there already has the same content, compared by hash
+* An unchanged file keeps its modification time
+************************/
+func writeIfChanged(path string, data []byte) error {
+	if f, err := os.Open(path); err == nil {
+		hash := sha256.New()
+		_, err := io.Copy(hash, f)
+		f.Close()
+		if sum := sha256.Sum256(data); err == nil && bytes.Equal(hash.Sum(nil), sum[:]) {
+			return nil
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
 func help() string {
 	return `
 ez-ssg		Create a static website like chettriyuvraj.github.io in 5 minutes.
@@ -834,6 +4445,9 @@ Usage: ez-ssg <command> [argument]
 
 Options:
 	-h	Specify this flag in the command and we'll show you this help screen (e.g. ez-ssg -h)
+	-V, --version	Prints the version of ez-ssg, same as the version command.
+	--no-color	Never color the output. Output is colored when written to a terminal, unless the NO_COLOR environment variable is set.
+	--force-color	Always color the output, even when it isn't written to a terminal.
 
 Commands:
 
@@ -841,42 +4455,171 @@ Commands:
   generate		Generates the static site.
   post			Creates a new post
   tag			Creates one/multiple new tag under which posts can be classified.
-  serve			Serves the static site at the specified port. Port 3000 by default in GUI.
+  serve			Serves the static site at the specified port, 3000 by default.
+  preview		Generates the site into a temporary directory, serves it and opens it in your browser.
+  migrate		Migrates Jekyll/Hugo posts into markdown/posts.
+  validate		Reports malformed frontmatter in posts/pages and malformed tags.
+  lint			Reports common content issues in posts/pages.
+  publish		Publishes a draft post.
+  export		Prints the parsed site as JSON for external tools.
+  doctor		Checks your setup and content, printing what's wrong.
+  version		Prints the version of ez-ssg.
   interactive		Starts interactive command line interface
 
 Commands Usage:
 
   init
 
-  Usage: ez-ssg init
+  Usage: ez-ssg init [options]
+
+  Options:
+    --format	Format of the sample config: json (the default, config.json), yaml (config.yaml) or toml (config.toml).
+    --with-examples	Also creates an example post and tag, so that the generated site has something to show.
+
+  The config has no setting for build timestamps such as the copyright year - set SOURCE_DATE_EPOCH
+  (seconds since 1970-01-01 UTC) when generating to use a fixed time instead of the current one.
+
+
+  generate
+
+  Usage: ez-ssg generate [options]
+
+  Drafts (posts with "draft": true) are not published. Once generated, the size of the site and its largest files are printed.
+
+  Options:
+    --json	Prints the size of the generated site as JSON instead of text, for scripts.
+    --profile	Writes a CPU profile of the generation to the file passed, for 'go tool pprof'.
+    --memprofile	Writes a memory profile once generated to the file passed, for 'go tool pprof'.
+    --prune	Instead of recreating the site directory, only updates changed files and removes files which are no longer generated.
+    --dry-run	With --prune, prints what would change without touching the site directory.
+    --drafts	Also renders each draft to an unlisted URL under _drafts and prints it, so that it can be shared before publishing.
+    --strict	Fails if anything is warned about while generating, e.g. a post without content or a tag file which can't be parsed, for CI.
+    --output	Generates the site into this directory instead of docs (or output_dir in the config) for this run only, e.g. a CI artifact path.
+    --env	Environment to generate the site for, production by default. Analytics are left out of any other e.g. --env development.
+    --quiet	Doesn't show the progress of rendering posts. It is shown as a progress bar on a terminal, and as a line per post otherwise.
+    --force	Replaces the site directory even if it isn't empty and wasn't generated by ez-ssg (it has no .ez-ssg file).
+    --jobs	Number of posts rendered at once, the number of CPUs by default. Lower it on constrained CI runners e.g. --jobs 2.
+    --dump-ast	Prints the markdown AST of the post file passed instead of generating, to find out why it renders unexpectedly e.g. --dump-ast markdown/posts/My_Post.md.
+
+  Timestamps in the generated site, such as the copyright year, use the current time - or SOURCE_DATE_EPOCH (seconds since 1970-01-01 UTC) if set, so that generating the same content twice gives identical files.
+
+
+  post
+
+  Usage: ez-ssg post [--] <title 1> <title 2> .. [options]
+
+  Creates one post for each title. Put -- before the titles to create a post named like a subcommand, e.g. ez-ssg post -- retag.
+
+  Options:
+    -t	Specify space-separated tags for the posts, must come last. You must create the tag beforehand using the tag command.
+    --no-tags	Creates the posts without tags (the default).
+
+  Usage: ez-ssg post retag <title> [options]
+
+  Changes the tags of an existing post.
+
+  Options:
+    --add	Tag to add to the post, can be repeated or comma-separated. You must create the tag beforehand using the tag command.
+    --remove	Tag to remove from the post, can be repeated or comma-separated.
+
+
+  tag
+
+  Usage: ez-ssg tag <tag 1> <tag2> .. [options]
+
+  Options:
+    --name		Display name for the tag e.g. "Go Programming". Only for a single tag.
+    --description	Description shown on the tag's page. Only for a single tag. Can be shortened to --desc.
+  
+
+  interactive
+
+  Usage: ez-ssg interactive
+
+
+  serve
+
+  Usage: ez-ssg serve [port-number] [options]
+
+  Serves on localhost only by default, at port 3000 unless another one is passed. The URL of the site is printed once it is served.
+
+  Options:
+    -p, --port	Port to serve at, same as passing the port number.
+    --no-cache	Tells browsers not to cache anything, so that every refresh shows the latest generated site.
+    --addr	host:port to listen on e.g. 0.0.0.0:3000 to serve on all interfaces. Takes precedence over the port number, which can then be left out.
+    --open	Opens the site in your default browser once the server has started.
+    --verbose	Logs the path and status of every request.
+    --output	Serves the site generated into this directory instead of docs (or output_dir in the config), see generate --output.
+
+
+  preview
+
+  Usage: ez-ssg preview [port-number] [options]
+
+  Port 3000 by default. The temporary directory is deleted when you stop the server using Ctrl+C.
+  The site is generated for the development environment, so analytics are left out.
+
+  Options:
+    --verbose	Logs the path and status of every request.
+    --drafts	Also renders each draft to an unlisted URL under _drafts and prints it, with a DRAFT banner on its page.
+
+
+  migrate
+
+  Usage: ez-ssg migrate <directory>
+
+  Reads markdown files with YAML frontmatter (---) from the directory and maps title, date, tags/categories, draft and description.
+  Any other frontmatter fields are reported as unmapped.
+
+
+  validate
+
+  Usage: ez-ssg validate
+
+
+  lint
+
+  Usage: ez-ssg lint [options]
 
+  Reports posts and pages without a title or description, images missing from the assets folder,
+  headings which skip a level (e.g. h2 to h4) and trailing whitespace.
 
-  generate
+  Options:
+    --skip	Checks to leave out, comma separated or repeated: title, description, images, headings, whitespace.
 
-  Usage: ez-ssg generate
 
+  publish
 
-  post
+  Usage: ez-ssg publish <title> [options]
 
-  Usage: ez-ssg post <title> [options]
+  Sets draft to false and the date of the post to today.
 
   Options:
-    -t	Specify space-separated tags for the post. You must create the tag beforehand using the tag command.
+    --date	Publish date instead of today, e.g. 2024-02-21.
+    --generate	Generates the static site once the post is published.
 
 
-  tag
+  export
 
-  Usage: ez-ssg tag <tag 1> <tag2> ..
-  
+  Usage: ez-ssg export --json
 
-  interactive
+  Prints the config, the metadata of all posts (including drafts) and the tags as JSON.
 
-  Usage: ez-ssg interactive
 
+  doctor
 
-  serve
+  Usage: ez-ssg doctor
 
-  Usage: ez-ssg serve <port-number>
+  Checks that the config file is valid, the content directories exist, every post, page and tag parses,
+  every tag used by a post exists, no two posts resolve to the same page, every included snippet exists
+  and the site directory is writable.
+  
+
+  version
+
+  Usage: ez-ssg version
+
+  Prints the version of ez-ssg, the commit it was built from and the Go version it was built with, e.g. for bug reports.
   
 `
 }
@@ -908,11 +4651,124 @@ func formatDate(t time.Time) string {
 	return t.Format("Jan") + fmt.Sprintf(" %d%s, %d", day, suffix, t.Year())
 }
 
+/***********************
+* Parses a date stored by formatDate e.g. "Feb 21st, 2024"
+************************/
+func parseDate(date string) (time.Time, error) {
+	m := storedDateRegex.FindStringSubmatch(strings.TrimSpace(date))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected a date like \"Feb 21st, 2024\"", date)
+	}
+	return time.Parse("Jan 2, 2006", fmt.Sprintf("%s %s, %s", m[1], m[2], m[3]))
+}
+
+/***********************
+* Parses a date passed on the command line or written by hand in a post - either as stored e.g. "Feb 21st, 2024" or as YYYY-MM-DD
+************************/
+func parseDateFlag(date string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t, nil
+	}
+	if t, err := parseDate(date); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q: expected a date like 2024-02-21 or \"Feb 21st, 2024\"", date)
+}
+
+/***********************
+* Formats a stored date for display using a named preset or a Go layout
+* Dates which can't be parsed, or an empty format, leave the date as stored
+************************/
+func displayDate(date string, format string) string {
+	if layout, ok := dateFormats[format]; ok {
+		format = layout
+	}
+	t, err := parseDate(date)
+	if format == "" || err != nil {
+		return date
+	}
+	return t.Format(format)
+}
+
+/***********************
+* Helper functions available inside includes and layouts
+* formatDate displays a post's date using the date_format config, or the format passed e.g. {{ formatDate .Date "iso" }}
+************************/
+func templateFuncs(site SiteData) template.FuncMap {
+	return template.FuncMap{
+		"formatDate": func(date string, format ...string) string {
+			if len(format) > 0 {
+				return displayDate(date, format[0])
+			}
+			return displayDate(date, site.DateFormat)
+		},
+		"icon": func(name string) template.HTML {
+			svg, ok := site.Icons[name]
+			if !ok {
+				warn("unknown icon %q, add it as %s", name, filepath.Join(MARKDOWN_DIR, ICONS_DIR, name+".svg"))
+			}
+			return svg
+		},
+	}
+}
+
+/***********************
+* Returns the time the site is generated at, which every timestamp in the generated site derives from
+* For reproducible builds, SOURCE_DATE_EPOCH (seconds since the Unix epoch) is used instead of the current time when set
+************************/
+func buildTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return now(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, must be a number of seconds since 1970-01-01 UTC: %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+/***********************
+* Reads the SVG icons templates can inline, keyed by name e.g. "github" for github.svg
+* Icons in contentDir/icons are added to the default ones, replacing those with the same name
+************************/
+func loadIcons(contentDir string) (map[string]template.HTML, error) {
+	icons := map[string]template.HTML{}
+	defaults, err := fs.Sub(iconsEFS, ICONS_DIR)
+	if err != nil {
+		return nil, fmt.Errorf("error reading default icons: %w", err)
+	}
+	for _, fsys := range []fs.FS{defaults, os.DirFS(filepath.Join(contentDir, ICONS_DIR))} {
+		names, err := fs.Glob(fsys, "*.svg")
+		if err != nil {
+			return nil, fmt.Errorf("error finding icons: %w", err)
+		}
+		for _, name := range names {
+			svg, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf("error reading icon %s: %w", name, err)
+			}
+			icons[strings.TrimSuffix(name, ".svg")] = template.HTML(bytes.TrimSpace(svg))
+		}
+	}
+	return icons, nil
+}
+
 /***********************
 * Writes metadata as frontmatter to a particular file
 * Creates file if it does not exist, otherwise truncates
 ************************/
 func addFrontmatter(filepath string, data []byte) error {
+	return writePost(filepath, data, nil)
+}
+
+/***********************
+* Writes metadata as frontmatter followed by the markdown body to a particular file
+* The body is written exactly as passed, so that commands which only edit the frontmatter
+* of an existing post (e.g. retag) can pass back the body returned by readPost() untouched
+* Creates file if it does not exist, otherwise truncates
+************************/
+func writePost(filepath string, data []byte, body []byte) error {
 	var buf bytes.Buffer
 
 	if _, err := buf.WriteString(FRONTMATTER_BOUNDARY + "\n"); err != nil {
@@ -924,9 +4780,12 @@ func addFrontmatter(filepath string, data []byte) error {
 	if _, err := buf.WriteString("\n" + FRONTMATTER_BOUNDARY + "\n"); err != nil {
 		return fmt.Errorf("error writing opening boundary to buffer: %w", err)
 	}
+	if _, err := buf.Write(body); err != nil {
+		return fmt.Errorf("error writing content to buffer: %w", err)
+	}
 
 	if err := os.WriteFile(filepath, buf.Bytes(), 0755); err != nil {
-		return fmt.Errorf("error writing frontmatter to file: %w", err)
+		return fmt.Errorf("error writing post to file: %w", err)
 	}
 
 	return nil
@@ -942,46 +4801,30 @@ func addFrontmatter(filepath string, data []byte) error {
 ************************/
 
 func readPost(filepath string) (frontmatter []byte, content []byte, err error) {
-	var bufFrontMatter, bufContent bytes.Buffer
-
-	f, err := os.Open(filepath)
+	raw, err := os.ReadFile(filepath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error opening file: %w", err)
 	}
-	defer f.Close()
 
+	/* If we haven't encountered frontmatter boundary twice (open/close) we are still parsing frontmatter */
 	boundaryCount := 0
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		/* If we haven't encountered frontmatter boundary twice (open/close) we are still parsing frontmatter */
-		if string(b) == FRONTMATTER_BOUNDARY && boundaryCount < 2 {
+	rest := raw
+	for len(rest) > 0 && boundaryCount < 2 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if string(line) == FRONTMATTER_BOUNDARY {
 			boundaryCount += 1
 			continue
 		}
 
-		/* If frontmatter */
-		if boundaryCount < 2 {
-			if _, err := bufFrontMatter.Write(b); err != nil {
-				return nil, nil, fmt.Errorf("error reading frontmatter: %w", err)
-			}
-			continue
-		}
-
-		/* Content */
-		if _, err := bufContent.Write(b); err != nil {
-			return nil, nil, fmt.Errorf("error reading content: %w", err)
-		}
-		if _, err := bufContent.Write([]byte("\n")); err != nil {
-			return nil, nil, fmt.Errorf("error reading content: %w", err)
-		}
-		continue
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, nil, fmt.Errorf("error post reading file: %w", err)
+		/* Frontmatter lines are kept intact so that errors can be traced back to a line */
+		frontmatter = append(frontmatter, line...)
+		frontmatter = append(frontmatter, '\n')
 	}
 
-	return bufFrontMatter.Bytes(), bufContent.Bytes(), nil
+	/* Content is everything after the closing boundary, byte for byte */
+	return frontmatter, rest, nil
 }
 
 /***********************
@@ -993,47 +4836,492 @@ func (p Post) ContainsTag(tag string) bool {
 	return slices.Contains(p.Tags, tag)
 }
 
+/* Whether an empty .nojekyll file is written into the site, true unless turned off */
+func (c Config) WritesNoJekyll() bool {
+	return c.NoJekyll == nil || *c.NoJekyll
+}
+
+/* Folder of the site the assets are copied to, slash-separated e.g. "assets" or "static/css" */
+func (c Config) AssetsDir() string {
+	return strings.Trim(cmp.Or(c.Paths.Assets, "/"+ASSETS_DIR), "/")
+}
+
+/* Absolute URL of the assets, used by templates e.g. {{ .Site.AssetsURL }}/style.css */
+func (c Config) AssetsURL() string {
+	return c.URL + "/" + c.AssetsDir()
+}
+
+/* Link to edit the source of a post using the edit_url_template config, empty if there is none or the post wasn't read from a file */
+func (c Config) EditURL(post Post) string {
+	if c.EditURLFormat == "" || post.SourcePath == "" {
+		return ""
+	}
+	return strings.ReplaceAll(c.EditURLFormat, "{path}", post.SourcePath)
+}
+
+/* Whether the page listing every tag is generated, true unless turned off */
+func (c Config) HasTagsPage() bool {
+	return c.TagsPage == nil || *c.TagsPage
+}
+
+/* Whether the default assets are copied into the site along with the user's, true unless turned off */
+func (c Config) UsesEmbeddedAssets() bool {
+	return c.EmbeddedAssets == nil || *c.EmbeddedAssets
+}
+
+/***********************
+* Whether a post should be listed in feeds/the sitemap
+* Posts are included unless they opt out in their frontmatter - a post which isn't indexed is never in the sitemap
+************************/
+func (p Post) IncludedInFeed() bool {
+	return p.InFeed == nil || *p.InFeed
+}
+
+/***********************
+* Used inside the head include to add the post's own head_extra HTML without escaping it
+************************/
+func (p Post) HeadExtraHTML() template.HTML {
+	return template.HTML(strings.Join(p.HeadExtra, "\n    "))
+}
+
+func (p Post) IncludedInSitemap() bool {
+	return !p.NoIndex && (p.InSitemap == nil || *p.InSitemap)
+}
+
+/***********************
+* Used inside a template to display tags grouped by category
+* Categories are sorted by name, uncategorized tags are grouped last
+************************/
+func (c Config) TagGroups() []TagGroup {
+	groups := []TagGroup{}
+	var uncategorized []Tag
+	for _, tag := range c.Tags {
+		if tag.Category == "" {
+			uncategorized = append(uncategorized, tag)
+			continue
+		}
+		i := slices.IndexFunc(groups, func(g TagGroup) bool { return g.Category == tag.Category })
+		if i == -1 {
+			groups = append(groups, TagGroup{Category: tag.Category})
+			i = len(groups) - 1
+		}
+		groups[i].Tags = append(groups[i].Tags, tag)
+	}
+
+	slices.SortStableFunc(groups, func(a, b TagGroup) int { return strings.Compare(a.Category, b.Category) })
+	if len(uncategorized) > 0 {
+		groups = append(groups, TagGroup{Tags: uncategorized})
+	}
+	return groups
+}
+
+/***********************
+* Used inside a template to display a tag
+* Falls back to the slug if the tag has no name
+************************/
+func (t Tag) DisplayName() string {
+	if t.Name == "" {
+		return t.Slug
+	}
+	return t.Name
+}
+
 /***********************
 * Helper functions to convert markdown to HTML
 ************************/
 
 /***********************
-* Converts raw markdown to raw HTML
+* Converts the raw markdown of a post to raw HTML
+* Also records what the rendered post contains (e.g. code blocks) so that
+* includes only add supporting scripts to the pages which need them
 * Reference: https://github.com/gomarkdown/markdown/blob/master/examples/basic.go
 ************************/
 
-func mdToHTML(md []byte) []byte {
+func renderMarkdown(post *Post, cfg Config) error {
+	doc, err := parseMarkdown(*post, cfg)
+	if err != nil {
+		return err
+	}
+
+	/* Rewrite internal links e.g. [my other post](post:my_other_post) */
+	if err := resolveLinks(doc, cfg); err != nil {
+		return err
+	}
+
+	post.HasCode, post.HasMath = false, false
+	var text strings.Builder
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Text:
+			text.Write(n.Literal)
+		case *ast.Code:
+			text.Write(n.Literal)
+		case *ast.Paragraph, *ast.Heading, *ast.Softbreak, *ast.Hardbreak:
+			text.WriteString(" ")
+		case *ast.CodeBlock:
+			if isMathBlock(n, cfg) {
+				post.HasMath = true
+			} else {
+				post.HasCode = true
+			}
+		case *ast.Math, *ast.MathBlock:
+			post.HasMath = true
+		}
+		return ast.GoToNext
+	})
+
+	post.Excerpt = excerpt(text.String(), EXCERPT_LENGTH)
+
+	/* Create HTML renderer with extensions */
+	if post.NewTabLinks != nil {
+		cfg.ExternalNewTab = *post.NewTabLinks
+	}
+	renderer := newCustomizedRender(cfg)
+
+	post.HTML = markdown.Render(doc, renderer)
+	return nil
+}
+
+/***********************
+* Parses the markdown of a post, with its snippets included, into an AST the way it is rendered
+************************/
+func parseMarkdown(post Post, cfg Config) (ast.Node, error) {
 	/* Create markdown parser with extensions */
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.FencedCode
+	/* '$' is only treated as math when enabled, otherwise e.g. "$5 or $10" would be rendered as math */
+	if !cfg.Math {
+		extensions &^= parser.MathJax
+	}
+	source, err := expandIncludes(post.Markdown, filepath.Join(cmp.Or(cfg.ContentDir, MARKDOWN_DIR), INCLUDES_DIR), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error including snippets in %s: %w", cmp.Or(post.RootName, post.Title), err)
+	}
 	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(md)
+	return p.Parse(source), nil
+}
 
-	/* Create HTML renderer with extensions */
-	renderer := newCustomizedRender()
+/***********************
+* Prints the AST a post or page is parsed into, to find out why its markdown renders unexpectedly
+* The site's config is used if there is one, e.g. for math - nothing is generated
+************************/
+func dumpMarkdownAST(w io.Writer, path string) error {
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	post, err := parsePost(path)
+	if err != nil {
+		return err
+	}
+	doc, err := parseMarkdown(post, cfg)
+	if err != nil {
+		return err
+	}
+	ast.Print(w, doc)
+	return nil
+}
+
+/***********************
+* Replaces every {{% include "<name>" %}} in markdown with the content of the snippet dir/<name>, itself expanded
+* Directives in fenced code blocks and inline code are left as they are, so that they can be written about
+* included lists the snippets being expanded, so that a snippet including itself (even indirectly) is an error
+************************/
+func expandIncludes(markdown []byte, dir string, included []string) ([]byte, error) {
+	var expanded []byte
+	inFence := false
+	for _, line := range bytes.SplitAfter(markdown, []byte("\n")) {
+		trimmed := bytes.TrimLeft(line, " ")
+		fence := bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~"))
+		if fence {
+			inFence = !inFence
+		}
+		if fence || inFence {
+			expanded = append(expanded, line...)
+			continue
+		}
+
+		start := 0
+		for _, span := range codeSpans(line) {
+			text, err := expandDirectives(line[start:span[0]], dir, included)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(append(expanded, text...), line[span[0]:span[1]]...)
+			start = span[1]
+		}
+		text, err := expandDirectives(line[start:], dir, included)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, text...)
+	}
+	return expanded, nil
+}
+
+/***********************
+* Returns the start and end of every inline code span in a line of markdown
+* A span starts with a run of backticks and ends at the next run of as many backticks, e.g. `code` or ``a ` b``
+************************/
+func codeSpans(line []byte) [][2]int {
+	var spans [][2]int
+	run := func(i int) int {
+		n := 0
+		for i+n < len(line) && line[i+n] == '`' {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < len(line); {
+		n := run(i)
+		if n == 0 {
+			i++
+			continue
+		}
+		end := -1
+		for j := i + n; j < len(line); {
+			if m := run(j); m == n {
+				end = j + m
+				break
+			} else if m > 0 {
+				j += m
+			} else {
+				j++
+			}
+		}
+		if end == -1 {
+			/* An unmatched run of backticks is plain text */
+			i += n
+			continue
+		}
+		spans = append(spans, [2]int{i, end})
+		i = end
+	}
+	return spans
+}
+
+/***********************
+* Expands the include directives of text, which has no code in it - see expandIncludes()
+************************/
+func expandDirectives(text []byte, dir string, included []string) ([]byte, error) {
+	var err error
+	expanded := includeRegex.ReplaceAllFunc(text, func(match []byte) []byte {
+		if err != nil {
+			return match
+		}
+		name := string(includeRegex.FindSubmatch(match)[1])
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			err = fmt.Errorf("included snippet %q must be a path within %s", name, dir)
+			return match
+		}
+		if slices.Contains(included, name) {
+			err = fmt.Errorf("include cycle: %s -> %s", strings.Join(included, " -> "), name)
+			return match
+		}
+
+		var snippet []byte
+		if snippet, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			err = fmt.Errorf("error reading included snippet: %w", err)
+			return match
+		}
+		var expanded []byte
+		if expanded, err = expandIncludes(snippet, dir, append(slices.Clone(included), name)); err != nil {
+			return match
+		}
+		return bytes.TrimRight(expanded, "\n")
+	})
+	return expanded, err
+}
+
+/***********************
+* Sets the summary of a post shown on the blog listings page
+*
+* 1. The summary in its frontmatter, rendered as markdown - the excerpt is left as it is, since meta tags don't use the summary
+* 2. Else the HTML of its markdown up to the excerpt separator - the excerpt, i.e. the fallback description, is then taken from it as well
+* 3. Else the excerpt of its text, escaped as a paragraph
+************************/
+func summarizePost(post *Post, cfg Config) error {
+	if post.SummaryText != "" {
+		summary := Post{Markdown: []byte(post.SummaryText), NewTabLinks: post.NewTabLinks}
+		if err := renderMarkdown(&summary, cfg); err != nil {
+			return err
+		}
+		post.Summary = template.HTML(summary.HTML)
+		return nil
+	}
+
+	before, _, found := bytes.Cut(post.Markdown, []byte(excerptSep(cfg)))
+	if !found {
+		if post.Excerpt != "" {
+			post.Summary = template.HTML("<p>" + template.HTMLEscapeString(post.Excerpt) + "</p>")
+		}
+		return nil
+	}
+	summary := Post{Markdown: before, NewTabLinks: post.NewTabLinks}
+	if err := renderMarkdown(&summary, cfg); err != nil {
+		return err
+	}
+	post.Summary = template.HTML(summary.HTML)
+	post.Excerpt = summary.Excerpt
+	return nil
+}
+
+/* The marker ending the summary of a post, see summarizePost() */
+func excerptSep(cfg Config) string {
+	return cmp.Or(cfg.ExcerptSep, "<!--more-->")
+}
+
+/***********************
+* Shortens text to at most n characters, cutting at a word boundary where possible
+* Whitespace is collapsed, and an ellipsis is added if the text was shortened
+************************/
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+/***********************
+* Replaces links using the 'post:' and 'tag:' schemes with the permalink of the post/tag they refer to
+* E.g. [see my other post](post:my_other_post) or [more on golang](tag:golang)
+* Any fragment is preserved e.g. post:my_other_post#conclusion
+* Returns an error if the referenced post/tag does not exist
+************************/
+func resolveLinks(doc ast.Node, cfg Config) error {
+	var err error
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		dest := string(link.Destination)
+		scheme, ref, found := strings.Cut(dest, ":")
+		if !found || (scheme != "post" && scheme != "tag") {
+			return ast.GoToNext
+		}
+		slug, fragment, _ := strings.Cut(ref, "#")
+		if fragment != "" {
+			fragment = "#" + fragment
+		}
+
+		var resolved string
+		switch scheme {
+		case "post":
+			/* Posts are rendered concurrently into cfg.Posts, so only fields set before rendering are read - not whole posts */
+			for i := range cfg.Posts {
+				if slugify(cfg.Posts[i].RootName) == slugify(slug) {
+					resolved = cfg.Posts[i].Permalink
+					break
+				}
+			}
+		case "tag":
+			for _, tag := range cfg.Tags {
+				if tag.Slug == strings.ToLower(slug) {
+					resolved = tagPermalink(cfg, tag.Slug)
+					break
+				}
+			}
+		}
+		if resolved == "" {
+			err = fmt.Errorf("link %q refers to a %s that does not exist", dest, scheme)
+			return ast.Terminate
+		}
+
+		link.Destination = []byte(resolved + fragment)
+		return ast.GoToNext
+	})
+
+	return err
+}
+
+/***********************
+* Fenced code blocks with the 'math' language are display math when math is enabled
+************************/
+func isMathBlock(c *ast.CodeBlock, cfg Config) bool {
+	return cfg.Math && strings.TrimSpace(string(c.Info)) == "math"
+}
 
-	return markdown.Render(doc, renderer)
+/***********************
+* Renders display math the same way gomarkdown renders $$...$$ so that KaTeX picks it up
+************************/
+func renderMathBlock(w io.Writer, c *ast.CodeBlock, entering bool) {
+	if entering {
+		io.WriteString(w, `<p><span class="math display">\[`)
+		html.EscapeHTML(w, c.Literal)
+		io.WriteString(w, `\]</span></p>`)
+	}
 }
 
-func renderCodeBlock(w io.Writer, c *ast.CodeBlock, entering bool) {
+func renderCodeBlock(w io.Writer, c *ast.CodeBlock, entering bool, opts CodeBlocks) {
 	if entering {
-		io.WriteString(w, "<div class='highlight'><pre class='highlight'><code>")
-		io.WriteString(w, string(c.Literal))     // Write the code content
+		io.WriteString(w, "<div class='highlight'>")
+		if opts.CopyButton {
+			io.WriteString(w, "<button class='copy-code' type='button'>Copy</button>")
+		}
+		io.WriteString(w, "<pre class='highlight'><code>")
+		if opts.LineNumbers {
+			/* Each line is wrapped in a span, the numbers themselves are CSS counters */
+			lines := strings.Split(strings.TrimSuffix(string(c.Literal), "\n"), "\n")
+			for _, line := range lines {
+				io.WriteString(w, "<span class='line'>"+line+"</span>\n")
+			}
+		} else {
+			io.WriteString(w, string(c.Literal)) // Write the code content
+		}
 		io.WriteString(w, "</code></pre></div>") // Immediately close tags
 	}
 }
 
-func myRenderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
-	if codeBlock, ok := node.(*ast.CodeBlock); ok {
-		renderCodeBlock(w, codeBlock, entering)
-		return ast.GoToNext, true
+func myRenderHook(cfg Config) html.RenderNodeFunc {
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		if codeBlock, ok := node.(*ast.CodeBlock); ok {
+			if isMathBlock(codeBlock, cfg) {
+				renderMathBlock(w, codeBlock, entering)
+			} else {
+				renderCodeBlock(w, codeBlock, entering, cfg.CodeBlocks)
+			}
+			return ast.GoToNext, true
+		}
+		/* Only add the attributes, the link itself is rendered as usual */
+		/* rel keeps the linked site from reaching back into this page through window.opener (reverse tabnabbing) */
+		if link, ok := node.(*ast.Link); ok && entering && isExternalLink(string(link.Destination), cfg.URL) {
+			if cfg.ExternalNewTab {
+				link.AdditionalAttributes = append(link.AdditionalAttributes, `target="_blank"`)
+			}
+			link.AdditionalAttributes = append(link.AdditionalAttributes, `rel="noopener noreferrer"`)
+		}
+		return ast.GoToNext, false
+	}
+}
+
+/***********************
+* Whether a link points to another site i.e. an http(s) URL whose host differs from the host of the site URL
+* Relative links, fragments and other schemes such as mailto: are never external
+************************/
+func isExternalLink(dest string, siteURL string) bool {
+	u, err := url.Parse(dest)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
 	}
-	return ast.GoToNext, false
+	site, err := url.Parse(siteURL)
+	if err != nil {
+		return true
+	}
+	return !strings.EqualFold(u.Hostname(), site.Hostname())
 }
 
-func newCustomizedRender() *html.Renderer {
+func newCustomizedRender(cfg Config) *html.Renderer {
 	opts := html.RendererOptions{
-		Flags:          html.CommonFlags | html.HrefTargetBlank,
-		RenderNodeHook: myRenderHook,
+		Flags:          html.CommonFlags,
+		RenderNodeHook: myRenderHook(cfg),
 	}
 	return html.NewRenderer(opts)
 }
@@ -1176,7 +5464,7 @@ func SetCurrentCmdInstruction(g *gocui.Gui, v *gocui.View) error {
 
 	/* Show inputs according to the command */
 	switch cmd {
-	case "init", "generate", "serve":
+	case "init", "generate", "serve", "preview":
 		inp1View.Frame = false
 		inp2View.Frame = false
 		inp1View.Clear()
@@ -1235,11 +5523,19 @@ func exec(g *gocui.Gui, cmd string) (msg string) {
 	var err error
 	var v1, v2 *gocui.View
 
+	/* The GUI has no --force, running generate again right after a refusal confirms it instead */
+	force := guiForceGenerate && cmd == "generate"
+	guiForceGenerate = false
+
 	switch cmd {
 	case "init":
-		err = initialize()
+		err = initialize("json", false)
 	case "generate":
-		err = generateStaticSite()
+		err = generateStaticSite(GenerateOptions{SiteDir: outputDir(), Force: force})
+		if errors.Is(err, errNotGeneratedSite) {
+			guiForceGenerate = true
+			return fmt.Sprintf("error executing generate command: %s\n\nRun generate again to replace it anyway.", err)
+		}
 	case "post":
 		v1, err = g.View("input1")
 		if err != nil {
@@ -1265,18 +5561,23 @@ func exec(g *gocui.Gui, cmd string) (msg string) {
 			return err.Error()
 		}
 
-		tags := []string{}
+		tags := []Tag{}
 		tagsBuffer := strings.TrimSpace(v1.Buffer())
 
 		if tagsBuffer == "" {
 			return errors.New("no tag values provided").Error()
 		}
 
-		tags = strings.Split(tagsBuffer, " ")
+		for _, slug := range strings.Split(tagsBuffer, " ") {
+			tags = append(tags, Tag{Slug: slug})
+		}
 		err = createTag(tags)
 
 	case "serve":
-		serveStaticSite(3000)
+		err = serveStaticSite(ServeOptions{Dir: outputDir(), Port: 3000})
+
+	case "preview":
+		err = previewStaticSite(PreviewOptions{Port: 3000})
 
 	default:
 		err = fmt.Errorf("command does not exist: %s", cmd)
@@ -1345,7 +5646,7 @@ func nextView(g *gocui.Gui, v *gocui.View) error {
 	}
 
 	/* No view switching for these commands */
-	if cmd == "generate" || cmd == "init" {
+	if cmd == "generate" || cmd == "init" || cmd == "preview" {
 		return nil
 	}
 
@@ -1430,6 +5731,9 @@ func layout(g *gocui.Gui) error {
 		v.SelBgColor = gocui.ColorGreen
 		v.SelFgColor = gocui.ColorBlack
 		for cmd := range commands {
+			if slices.Contains(cliOnlyCommands, cmd) {
+				continue
+			}
 			v.Write([]byte(cmd + "\n"))
 		}
 
@@ -1,9 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -58,3 +72,1441 @@ func TestAddReadFrontmatter(t *testing.T) {
 	require.Equal(t, cfgWant, cfgGot)
 
 }
+
+func TestParsePostArgs(t *testing.T) {
+	titles, tags, err := parsePostArgs([]string{"First", "Second", "-t", "golang", "python"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"First", "Second"}, titles)
+	require.Equal(t, []string{"golang", "python"}, tags)
+
+	/* "--" lets a title be named like a subcommand */
+	titles, tags, err = parsePostArgs([]string{"--", "retag", "--no-tags"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"retag"}, titles)
+	require.Empty(t, tags)
+
+	for _, args := range [][]string{{}, {"--"}, {"-t", "golang"}, {"First", "--no-tags", "-t", "golang"}} {
+		_, _, err = parsePostArgs(args)
+		require.Error(t, err, args)
+	}
+}
+
+func TestCreatePost(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	require.NoError(t, os.MkdirAll(filepath.Join(MARKDOWN_DIR, "posts"), 0750))
+	now = func() time.Time { return time.Date(2024, 2, 21, 9, 30, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	require.NoError(t, createPost("My Post", []string{"golang"}))
+	content, err := os.ReadFile(filepath.Join(MARKDOWN_DIR, "posts", "My_Post.md"))
+	require.NoError(t, err)
+	want := `------------------
+{
+  "title": "My Post",
+  "date": "Feb 21st, 2024",
+  "tags": [
+    "golang"
+  ]
+}
+------------------
+`
+	require.Equal(t, want, string(content))
+
+	require.Error(t, createPost("My Post", nil))
+}
+
+func TestGenerateSummaryAfterInit(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	/* What 'ez-ssg generate' does without --output, right after init */
+	require.NoError(t, initialize("json", true))
+	opts := GenerateOptions{SiteDir: outputDir()}
+	require.NoError(t, generateStaticSite(opts))
+	out := captureStdout(t, func() { err = printSiteSummary(opts.SiteDir, false) })
+	require.NoError(t, err)
+	require.Contains(t, out, "largest files:")
+	require.Contains(t, out, "index.html")
+}
+
+func TestOutputDir(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	require.Equal(t, SITE_DIR, outputDir())
+	require.NoError(t, initialize("json", false))
+	require.Equal(t, SITE_DIR, outputDir())
+
+	cfg, err := loadConfig()
+	require.NoError(t, err)
+	cfg.OutputDir = "public"
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configFile(), raw, 0644))
+	require.Equal(t, "public", outputDir())
+}
+
+func TestConfigFormatsRoundTrip(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	/* The sample config of every format loads into the same Config */
+	configs := map[string]Config{}
+	for _, format := range []string{"json", "yaml", "toml"} {
+		require.NoError(t, os.Chdir(t.TempDir()))
+		require.NoError(t, initialize(format, false))
+		require.Equal(t, map[string]string{"json": CONFIG_FILE, "yaml": "config.yaml", "toml": "config.toml"}[format], configFile())
+		cfg, err := loadConfig()
+		require.NoError(t, err)
+		configs[format] = cfg
+	}
+	require.Equal(t, configs["json"], configs["yaml"])
+	require.Equal(t, configs["json"], configs["toml"])
+
+	/* As does a config using more fields than the sample */
+	raw, err := json.Marshal(sampleCfg)
+	require.NoError(t, err)
+	yamlRaw, err := jsonToYAML(raw)
+	require.NoError(t, err)
+	tomlRaw, err := jsonToTOML(raw)
+	require.NoError(t, err)
+	for path, raw := range map[string][]byte{"config.json": raw, "config.yaml": yamlRaw, "config.toml": tomlRaw} {
+		converted, err := configToJSON(path, raw)
+		require.NoError(t, err, path)
+		var cfg Config
+		require.NoError(t, json.Unmarshal(converted, &cfg), path)
+		require.Equal(t, sampleCfg, cfg, path)
+	}
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	files := map[string]string{
+		CONFIG_FILE:   `{"title": "JSON"}`,
+		"config.yaml": "title: YAML\n",
+		"config.yml":  "title: YML\n",
+		"config.toml": "title = \"TOML\"\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	}
+
+	/* config.json wins, then config.yaml, config.yml and config.toml */
+	for _, want := range []struct{ file, title string }{{CONFIG_FILE, "JSON"}, {"config.yaml", "YAML"}, {"config.yml", "YML"}, {"config.toml", "TOML"}} {
+		require.Equal(t, want.file, configFile())
+		cfg, err := loadConfig()
+		require.NoError(t, err)
+		require.Equal(t, want.title, cfg.Title)
+		require.NoError(t, os.Remove(want.file))
+	}
+	require.Equal(t, CONFIG_FILE, configFile())
+}
+
+func TestInitializeWithExamples(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	require.NoError(t, initialize("json", true))
+	require.FileExists(t, filepath.Join(MARKDOWN_DIR, "tags", "ez-ssg.json"))
+	require.NoError(t, generateStaticSite(GenerateOptions{SiteDir: SITE_DIR, Progress: io.Discard}))
+	post, err := os.ReadFile(filepath.Join(SITE_DIR, "blog", "Hello_World.html"))
+	require.NoError(t, err)
+	require.Contains(t, string(post), `<a href="http://localhost:3000/tagged/ez-ssg/ez-ssg">a tag</a>`)
+	require.FileExists(t, filepath.Join(SITE_DIR, "tagged", "ez-ssg", "ez-ssg.html"))
+}
+
+func TestCheckDuplicatePosts(t *testing.T) {
+	/* Distinct titles */
+	err := checkDuplicatePosts([]string{
+		filepath.Join(MARKDOWN_DIR, "posts", "My_Post.md"),
+		filepath.Join(MARKDOWN_DIR, "posts", "Another_Post.md"),
+	}, nil)
+	require.NoError(t, err)
+
+	/* Titles which resolve to the same root name once slugified */
+	first := filepath.Join(MARKDOWN_DIR, "posts", "My Post.md")
+	second := filepath.Join(MARKDOWN_DIR, "posts", "my_post.md")
+	err = checkDuplicatePosts([]string{first, second}, nil)
+	require.ErrorContains(t, err, first)
+	require.ErrorContains(t, err, second)
+
+	/* Translations into configured languages are different pages */
+	err = checkDuplicatePosts([]string{
+		filepath.Join(MARKDOWN_DIR, "posts", "my_post.md"),
+		filepath.Join(MARKDOWN_DIR, "posts", "my_post.fr.md"),
+	}, []string{"fr"})
+	require.NoError(t, err)
+
+	/* A suffix which isn't a configured language is rendered as the site's language, clashing with the unsuffixed post */
+	for _, other := range []string{"Intro_to_Node.js.md", "Intro_to_Node.en.md"} {
+		first, second := filepath.Join(MARKDOWN_DIR, "posts", "Intro_to_Node.md"), filepath.Join(MARKDOWN_DIR, "posts", other)
+		err = checkDuplicatePosts([]string{first, second}, []string{"fr"})
+		require.ErrorContains(t, err, second)
+	}
+}
+
+func TestLinkTranslations(t *testing.T) {
+	posts := []Post{
+		{RootName: "my_post", Lang: "en", Permalink: "/blog/my_post"},
+		{RootName: "my_post", Lang: "fr", Permalink: "/fr/blog/my_post"},
+		{RootName: "only_french", Lang: "fr", Permalink: "/fr/blog/only_french"},
+	}
+	listed, translations := linkTranslations(posts, "en")
+
+	/* One version of each post is listed, preferably in the site's language */
+	require.Len(t, listed, 2)
+	require.Equal(t, "en", listed[0].Lang)
+	require.Equal(t, "only_french", listed[1].RootName)
+	require.Empty(t, listed[1].Translations)
+
+	/* Both versions link to one another */
+	require.Len(t, translations, 1)
+	want := []Translation{{Lang: "en", URL: "/blog/my_post"}, {Lang: "fr", URL: "/fr/blog/my_post"}}
+	require.Equal(t, want, listed[0].Translations)
+	require.Equal(t, want, translations[0].Translations)
+}
+
+func TestLoadSiteTagCounts(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Work In Progress", Tags: []string{"golang"}, Draft: true}, "Not yet\n")
+
+	site, err := loadSite(sampleCfg, contentDir)
+	require.NoError(t, err)
+	require.Len(t, site.Config.Tags, 1)
+	require.Equal(t, 1, site.Config.Tags[0].Count)
+
+	/* Every page type sees the tags with their counts */
+	require.Equal(t, 1, newSiteData(site.Config).Tags[0].Count)
+}
+
+func TestResolveTags(t *testing.T) {
+	tags := []Tag{{Slug: "golang", Name: "Go", Permalink: "/tagged/golang/golang"}}
+	posts := []Post{{Tags: []string{"Golang", "python"}}}
+	resolveTags(posts, tags)
+
+	/* Tags which were never created fall back to their slug */
+	require.Equal(t, []Tag{tags[0], {Slug: "python"}}, posts[0].ResolvedTags)
+	require.Equal(t, "Go", posts[0].ResolvedTags[0].DisplayName())
+	require.Equal(t, "python", posts[0].ResolvedTags[1].DisplayName())
+}
+
+func TestMissingContent(t *testing.T) {
+	require.Empty(t, missingContent(writeTestContent(t), postExtensions(Config{})))
+
+	contentDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, "posts"), 0750))
+	require.Len(t, missingContent(contentDir, postExtensions(Config{})), 4)
+}
+
+func TestCheckSiteDir(t *testing.T) {
+	siteDir := t.TempDir()
+	require.NoError(t, checkSiteDir(filepath.Join(siteDir, "missing"), false))
+	require.NoError(t, checkSiteDir(siteDir, false))
+
+	/* A non-empty directory without the marker e.g. the home directory */
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "notes.txt"), []byte("keep me"), 0644))
+	require.ErrorIs(t, checkSiteDir(siteDir, false), errNotGeneratedSite)
+	require.NoError(t, checkSiteDir(siteDir, true))
+
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, SITE_MARKER), nil, 0644))
+	require.NoError(t, checkSiteDir(siteDir, false))
+
+	/* A site generated before the marker existed */
+	oldSiteDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(oldSiteDir, "index.html"), nil, 0644))
+	require.Error(t, checkSiteDir(oldSiteDir, false))
+	require.NoError(t, os.WriteFile(filepath.Join(oldSiteDir, "blog.html"), nil, 0644))
+	require.NoError(t, checkSiteDir(oldSiteDir, false))
+}
+
+func TestGUIGenerateConfirmsForce(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	require.NoError(t, initialize("json", false))
+	require.NoError(t, os.MkdirAll(SITE_DIR, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(SITE_DIR, "notes.txt"), []byte("keep me"), 0644))
+
+	/* Running another command in between doesn't confirm it */
+	require.Contains(t, exec(nil, "generate"), "Run generate again to replace it anyway")
+	require.Contains(t, exec(nil, "missing"), "command does not exist")
+	require.Contains(t, exec(nil, "generate"), "Run generate again to replace it anyway")
+	require.FileExists(t, filepath.Join(SITE_DIR, "notes.txt"))
+
+	require.Equal(t, "successfully executed", exec(nil, "generate"))
+	require.FileExists(t, filepath.Join(SITE_DIR, SITE_MARKER))
+	require.NoFileExists(t, filepath.Join(SITE_DIR, "notes.txt"))
+}
+
+func TestWriteIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.html")
+	require.NoError(t, writeIfChanged(path, []byte("<p>hello</p>")))
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	/* Same content, the file is left alone */
+	require.NoError(t, writeIfChanged(path, []byte("<p>hello</p>")))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.True(t, info.ModTime().Equal(old))
+
+	require.NoError(t, writeIfChanged(path, []byte("<p>bye</p>")))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "<p>bye</p>", string(content))
+}
+
+func TestResetStaticSite(t *testing.T) {
+	siteDir := t.TempDir()
+	for _, name := range []string{"index.html", "blog/kept.html", "blog/deleted.html", "tagged/old/old.html"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(siteDir, name)), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(siteDir, name), nil, 0644))
+	}
+
+	require.NoError(t, resetStaticSite(siteDir, map[string]bool{"index.html": true, "blog": true, filepath.Join("blog", "kept.html"): true, "tagged": true}))
+	require.FileExists(t, filepath.Join(siteDir, "index.html"))
+	require.FileExists(t, filepath.Join(siteDir, "blog", "kept.html"))
+	require.NoFileExists(t, filepath.Join(siteDir, "blog", "deleted.html"))
+	require.NoDirExists(t, filepath.Join(siteDir, "tagged", "old"))
+	require.DirExists(t, filepath.Join(siteDir, "tagged"))
+}
+
+func TestRunHook(t *testing.T) {
+	require.NoError(t, runHook("pre_build", "", GenerateOptions{}))
+	require.NoError(t, runHook("post_build", `test "$EZ_SSG_SITE_DIR" = docs && test "$EZ_SSG_ENV" = production`, GenerateOptions{SiteDir: "docs"}))
+	require.ErrorContains(t, runHook("pre_build", "exit 3", GenerateOptions{}), "pre_build hook")
+}
+
+func TestGenerateStaticSiteHooksWhenPruning(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	require.NoError(t, initialize("json", false))
+	cfg, err := loadConfig()
+	require.NoError(t, err)
+	cfg.Hooks = &Hooks{PreBuild: "echo pre >> hooks.log", PostBuild: `test -f "$EZ_SSG_SITE_DIR/index.html" && echo "post $EZ_SSG_SITE_DIR" >> hooks.log`}
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(CONFIG_FILE, raw, 0644))
+
+	/* A dry run runs no hooks */
+	require.NoError(t, generateStaticSite(GenerateOptions{SiteDir: SITE_DIR, Prune: true, DryRun: true}))
+	require.NoFileExists(t, "hooks.log")
+
+	/* Hooks run once, post_build after the site is synced into the site directory */
+	require.NoError(t, generateStaticSite(GenerateOptions{SiteDir: SITE_DIR, Prune: true}))
+	log, err := os.ReadFile("hooks.log")
+	require.NoError(t, err)
+	require.Equal(t, "pre\npost "+SITE_DIR+"\n", string(log))
+}
+
+func TestDumpMarkdownAST(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "My_Post.md")
+	require.NoError(t, writePost(path, []byte(`{"title": "My Post"}`), []byte("# Hello\n\n```go\nfmt.Println()\n```\n")))
+
+	var buf bytes.Buffer
+	require.NoError(t, dumpMarkdownAST(&buf, path))
+	require.Contains(t, buf.String(), "Heading\n  Text 'Hello'")
+	require.Contains(t, buf.String(), "CodeBlock")
+}
+
+func TestLintPost(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ASSETS_DIR, "images"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ASSETS_DIR, "images", "found.png"), nil, 0644))
+	path := filepath.Join(dir, "My_Post.md")
+	markdown := "## Intro \nline break  \n\n![ok](/assets/images/found.png)\n![gone](/assets/images/gone.png)\n![remote](https://example.com/a.png)\n\n#### Details\n\n```\n# not a heading\n```\n"
+	require.NoError(t, writePost(path, []byte(`{"title": "My Post"}`), []byte(markdown)))
+	cfg := Config{URL: "https://example.com", ContentDir: dir}
+
+	problems, err := lintPost(path, cfg, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		path + ": no description",
+		path + ":8: image /assets/images/gone.png not found at " + filepath.Join(dir, ASSETS_DIR, "images", "gone.png"),
+		path + ":4: trailing whitespace",
+		path + ":11: heading skips from h2 to h4",
+	}, problems)
+
+	problems, err = lintPost(path, cfg, lintChecks)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	/* Relative images are looked up next to the post, and empty keys are reported on their line */
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "posts"), 0755))
+	path = filepath.Join(dir, "posts", "Relative.md")
+	markdown = "![ok](../assets/images/found.png)\n![gone](images/found.png)\n![escaped](/assets/images/gone\\_too.png)\n"
+	require.NoError(t, writePost(path, []byte("{\n  \"description\": \"Relative images\",\n  \"title\": \"\"\n}"), []byte(markdown)))
+
+	problems, err = lintPost(path, cfg, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		path + ":4: no title",
+		path + ":8: image images/found.png not found at " + filepath.Join(dir, "posts", "images", "found.png"),
+		path + ": image /assets/images/gone_too.png not found at " + filepath.Join(dir, ASSETS_DIR, "images", "gone_too.png"),
+	}, problems)
+}
+
+func TestExpandIncludes(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"disclaimer.md": "*Opinions are my own.* {{% include \"signature.md\" %}}\n",
+		"signature.md":  "- Yuvraj\n",
+		"a.md":          "{{% include \"b.md\" %}}",
+		"b.md":          "{{%include \"a.md\"%}}",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	got, err := expandIncludes([]byte("# Post\n\n{{% include \"disclaimer.md\" %}}\n"), dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, "# Post\n\n*Opinions are my own.* - Yuvraj\n", string(got))
+
+	_, err = expandIncludes([]byte(`{{% include "a.md" %}}`), dir, nil)
+	require.ErrorContains(t, err, "include cycle: a.md -> b.md -> a.md")
+	_, err = expandIncludes([]byte(`{{% include "missing.md" %}}`), dir, nil)
+	require.Error(t, err)
+	_, err = expandIncludes([]byte(`{{% include "../secret.md" %}}`), dir, nil)
+	require.Error(t, err)
+
+	/* Directives in code are left as they are, even ones which couldn't be expanded */
+	code := "Write `{{% include \"missing.md\" %}}` or ``{{% include \"a.md\" %}} ` ``, then {{% include \"signature.md\" %}}\n\n```\n{{% include \"missing.md\" %}}\n```\n\n~~~md\n{{% include \"a.md\" %}}\n~~~\n"
+	got, err = expandIncludes([]byte(code), dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, strings.Replace(code, `{{% include "signature.md" %}}`, "- Yuvraj", 1), string(got))
+	got, err = expandIncludes([]byte("An unmatched ` backtick {{% include \"signature.md\" %}}\n"), dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, "An unmatched ` backtick - Yuvraj\n", string(got))
+}
+
+/* Returns what fn prints to stdout */
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+	fn()
+	require.NoError(t, w.Close())
+	return string(<-out)
+}
+
+func TestDoctor(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	/* Before init, every problem is reported at once */
+	out := captureStdout(t, func() { err = doctor() })
+	require.ErrorContains(t, err, "checks failed")
+	require.Contains(t, out, "[fail] config file exists and is valid")
+	require.Contains(t, out, "[fail] content directories exist")
+	require.Contains(t, out, "run 'ez-ssg init' first")
+
+	require.NoError(t, initialize("json", false))
+	out = captureStdout(t, func() { err = doctor() })
+	require.NoError(t, err)
+	require.NotContains(t, out, "[fail]")
+	require.Contains(t, out, "[ok]   all tags used by posts exist")
+
+	writeTestPost(t, MARKDOWN_DIR, Post{Title: "Tagged", Tags: []string{"golang"}}, "Go\n")
+	out = captureStdout(t, func() { err = doctor() })
+	require.ErrorContains(t, err, "1 of 7 checks failed")
+	require.Contains(t, out, "[fail] all tags used by posts exist")
+	require.Contains(t, out, filepath.Join(MARKDOWN_DIR, "posts", "Tagged.md")+": tag golang does not exist")
+	require.Contains(t, out, "[ok]   all posts, pages and tags parse")
+}
+
+func TestDoctorIncludes(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	require.NoError(t, initialize("json", false))
+	require.DirExists(t, filepath.Join(MARKDOWN_DIR, INCLUDES_DIR))
+	require.NoError(t, os.WriteFile(filepath.Join(MARKDOWN_DIR, INCLUDES_DIR, "disclaimer.md"), []byte("Mine\n"), 0644))
+	writeTestPost(t, MARKDOWN_DIR, Post{Title: "Included"}, "{{% include \"disclaimer.md\" %}}\n")
+	require.Empty(t, doctorIncludes())
+
+	writeTestPost(t, MARKDOWN_DIR, Post{Title: "Missing"}, "{{% include \"missing.md\" %}} but not `{{% include \"gone.md\" %}}`\n")
+	problems := doctorIncludes()
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0], filepath.Join(MARKDOWN_DIR, "posts", "Missing.md"))
+	require.Contains(t, problems[0], "missing.md")
+}
+
+func TestServeStaticSitePortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	err = serveStaticSite(ServeOptions{Dir: t.TempDir(), Port: listener.Addr().(*net.TCPAddr).Port})
+	require.ErrorContains(t, err, "is already in use")
+}
+
+func TestIsAddrInUse(t *testing.T) {
+	/* As returned by net.Listen on Linux/macOS and on Windows */
+	for _, errno := range []syscall.Errno{syscall.EADDRINUSE, syscall.Errno(10048)} {
+		err := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", errno)}
+		require.True(t, isAddrInUse(err), errno)
+	}
+	require.False(t, isAddrInUse(&net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EACCES)}))
+	require.False(t, isAddrInUse(nil))
+}
+
+func TestParsePort(t *testing.T) {
+	for _, arg := range []string{"1", "3000", "65535"} {
+		_, err := parsePort(arg)
+		require.NoError(t, err, arg)
+	}
+	for _, arg := range []string{"0", "-1", "65536", "http"} {
+		_, err := parsePort(arg)
+		require.Error(t, err, arg)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	/* As set by -ldflags when building a release */
+	oldVersion, oldCommit := version, commit
+	t.Cleanup(func() { version, commit = oldVersion, oldCommit })
+	version, commit = "v2.1.0", "1a2b3c4d5e6f"
+	require.Equal(t, fmt.Sprintf("ez-ssg v2.1.0 (commit 1a2b3c4d5e6f, %s %s/%s)", runtime.Version(), runtime.GOOS, runtime.GOARCH), versionString())
+
+	/* Otherwise whatever the toolchain recorded is used, which a test binary has no version or commit for */
+	version, commit = "dev", ""
+	ver, _ := versionInfo()
+	require.Equal(t, "dev", ver)
+	require.True(t, strings.HasPrefix(versionString(), "ez-ssg dev (commit "), versionString())
+	require.True(t, strings.HasSuffix(versionString(), fmt.Sprintf(", %s %s/%s)", runtime.Version(), runtime.GOOS, runtime.GOARCH)), versionString())
+}
+
+func TestColors(t *testing.T) {
+	t.Cleanup(func() { colorMode = "auto" })
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	/* Output which isn't a terminal isn't colored by default */
+	require.Equal(t, "oops", colorize(f, COLOR_RED, "oops"))
+
+	require.Equal(t, []string{"ez-ssg", "generate", "--drafts"}, parseColorFlags([]string{"ez-ssg", "generate", "--force-color", "--drafts"}))
+	require.Equal(t, COLOR_RED+"oops"+COLOR_RESET, colorize(f, COLOR_RED, "oops"))
+	/* --force-color wins over NO_COLOR, as it is more specific */
+	t.Setenv("NO_COLOR", "1")
+	require.Equal(t, COLOR_RED+"oops"+COLOR_RESET, colorize(f, COLOR_RED, "oops"))
+
+	/* --no-color wins over --force-color */
+	require.Equal(t, []string{"ez-ssg", "lint"}, parseColorFlags([]string{"ez-ssg", "--force-color", "lint", "--no-color"}))
+	require.Equal(t, "never", colorMode)
+	require.Equal(t, "oops", colorize(f, COLOR_RED, "oops"))
+
+	/* Color flags after "--" are arguments of the command */
+	colorMode = "auto"
+	require.Equal(t, []string{"ez-ssg", "post", "--", "--no-color"}, parseColorFlags([]string{"ez-ssg", "post", "--", "--no-color"}))
+	require.Equal(t, "auto", colorMode)
+
+	/* In auto mode, NO_COLOR turns colors off whether or not the output is a terminal */
+	colorMode = "auto"
+	require.Equal(t, "oops", colorize(os.Stdout, COLOR_RED, "oops"))
+}
+
+func TestListenURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		"127.0.0.1:3000":   "http://localhost:3000",
+		"0.0.0.0:8080":     "http://localhost:8080",
+		"[::]:8080":        "http://localhost:8080",
+		"192.168.1.5:3000": "http://192.168.1.5:3000",
+		"[fe80::1]:3000":   "http://[fe80::1]:3000",
+	} {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		require.NoError(t, err)
+		require.Equal(t, want, listenURL(tcpAddr), addr)
+	}
+}
+
+func TestServeFileContentType(t *testing.T) {
+	dir := t.TempDir()
+	for name, want := range map[string]string{
+		"font.woff2":          "font/woff2",
+		"site.webmanifest":    "application/manifest+json",
+		"style.css":           "text/css; charset=utf-8",
+		"FAVICON.ICO":         "image/x-icon",
+		"no_extension_at_all": "text/plain; charset=utf-8",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("some text"), 0644))
+		rec := httptest.NewRecorder()
+		serveFile(rec, httptest.NewRequest("GET", "/"+name, nil), path)
+		require.Equal(t, want, rec.Header().Get("Content-Type"), name)
+	}
+}
+
+func TestSiteHandlerNoCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Hi</h1>"), 0644))
+
+	for noCache, want := range map[bool]string{true: "no-store, must-revalidate", false: ""} {
+		rec := httptest.NewRecorder()
+		siteHandler(ServeOptions{Dir: dir, NoCache: noCache}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, want, rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	err := forEach(20, 3, func(i int) error {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if i%2 == 1 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	require.LessOrEqual(t, most, 3)
+	require.Equal(t, "failed 1\nfailed 3\nfailed 5\nfailed 7\nfailed 9\nfailed 11\nfailed 13\nfailed 15\nfailed 17\nfailed 19", err.Error())
+}
+
+func TestGenerateToJobs(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for i := range 10 {
+		writeTestPost(t, contentDir, Post{Title: fmt.Sprintf("Post %d", i), Date: "2024-01-03", Tags: []string{"golang"}}, "Some text\n")
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	one, many := memWriteFS{}, memWriteFS{}
+	require.NoError(t, generateTo(one, sampleCfg, contentDir, GenerateOptions{Jobs: 1}))
+	require.NoError(t, generateTo(many, sampleCfg, contentDir, GenerateOptions{Jobs: 8}))
+	require.Equal(t, one, many)
+}
+
+func TestBuildTime(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	got, err := buildTime()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), got)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = buildTime()
+	require.Error(t, err)
+}
+
+func TestLoadIcons(t *testing.T) {
+	contentDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, ICONS_DIR), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, ICONS_DIR, "github.svg"), []byte("<svg id=\"mine\"></svg>\n"), 0644))
+
+	icons, err := loadIcons(contentDir)
+	require.NoError(t, err)
+	require.Equal(t, `<svg id="mine"></svg>`, string(icons["github"]))
+	require.Contains(t, string(icons["rss"]), "<svg")
+}
+
+func TestTagPosts(t *testing.T) {
+	posts := []Post{
+		{RootName: "a", Tags: []string{"golang"}},
+		{RootName: "b", Tags: []string{"python"}},
+		{RootName: "c", Tags: []string{"golang"}},
+		{RootName: "d", Tags: []string{"golang"}},
+	}
+	names := func(posts []Post) (names []string) {
+		for _, p := range posts {
+			names = append(names, p.RootName)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"a", "c", "d"}, names(tagPosts(Tag{Slug: "golang"}, posts)))
+	require.Equal(t, []string{"d", "b", "a", "c"}, names(tagPosts(Tag{Slug: "golang", Posts: []string{"d", "b"}}, posts)))
+
+	require.NoError(t, checkTagPosts([]Tag{{Slug: "golang", Posts: []string{"d", "b"}}}, posts))
+	require.Error(t, checkTagPosts([]Tag{{Slug: "golang", Posts: []string{"missing"}}}, posts))
+}
+
+func TestNewSiteData(t *testing.T) {
+	cfg := sampleCfg
+	cfg.Posts = []Post{{Title: "My post", Markdown: []byte("# Hello")}, {Title: "Pinned post", Pinned: true}}
+	cfg.Sections = []Section{{Dir: "projects", Pages: []Post{{Title: "My project", Markdown: []byte("# Project")}}}}
+
+	/* Pinned posts are listed first without reordering the posts of the config */
+	site := newSiteData(cfg)
+	require.Equal(t, "Pinned post", site.Posts[0].Title)
+	require.Equal(t, []byte("# Hello"), site.Posts[1].Markdown)
+	require.Equal(t, "My post", cfg.Posts[0].Title)
+	require.Equal(t, "My project", site.Sections[0].Pages[0].Title)
+}
+
+func TestDisplayDate(t *testing.T) {
+	date := formatDate(time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC))
+
+	require.Equal(t, "Jan 15th, 2024", displayDate(date, ""))
+	require.Equal(t, "2024-01-15", displayDate(date, "iso"))
+	require.Equal(t, "15 January 2024", displayDate(date, "long"))
+	require.Equal(t, "01/15/2024", displayDate(date, "01/02/2006"))
+
+	/* Dates which can't be parsed are displayed as stored */
+	require.Equal(t, "sometime in 2024", displayDate("sometime in 2024", "iso"))
+}
+
+func TestWritePostPreservesBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+
+	/* Body without a trailing newline, with CRLF line endings and a line looking like a frontmatter boundary */
+	body := []byte("# Heading\r\n\n" + FRONTMATTER_BOUNDARY + "\n  indented   \n\n\nlast line")
+	metadata, err := json.MarshalIndent(Post{Title: "Post", Tags: []string{"golang"}}, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, writePost(path, metadata, body))
+
+	/* Edit the frontmatter like retag does */
+	frontmatter, readBody, err := readPost(path)
+	require.NoError(t, err)
+	require.Equal(t, body, readBody)
+
+	var post Post
+	require.NoError(t, json.Unmarshal(frontmatter, &post))
+	post.Tags = append(post.Tags, "python")
+	metadata, err = json.MarshalIndent(post, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, writePost(path, metadata, readBody))
+
+	/* The body is byte-identical, both as read and on disk */
+	frontmatter, readBody, err = readPost(path)
+	require.NoError(t, err)
+	require.Equal(t, body, readBody)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, bytes.HasSuffix(raw, body))
+
+	require.NoError(t, json.Unmarshal(frontmatter, &post))
+	require.Equal(t, []string{"golang", "python"}, post.Tags)
+}
+
+func TestCopyAssetsUserAssetsWin(t *testing.T) {
+	sourceDir, siteDir := t.TempDir(), t.TempDir()
+	targetDir := filepath.Join(siteDir, ASSETS_DIR)
+
+	/* The user's own stylesheet, shadowing the default one */
+	userCSS := []byte("body { color: hotpink; }")
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "style.css"), userCSS, 0644))
+
+	require.NoError(t, copyAssets(dirWriteFS(siteDir), sourceDir, ASSETS_DIR, true))
+
+	got, err := os.ReadFile(filepath.Join(targetDir, "style.css"))
+	require.NoError(t, err)
+	require.Equal(t, userCSS, got)
+
+	/* Defaults which aren't shadowed are still copied */
+	_, err = os.Stat(filepath.Join(targetDir, "favicon.ico"))
+	require.NoError(t, err)
+}
+
+/* Creates a content folder with a homepage, blog listings page, a tag and a post under that tag */
+func writeTestContent(t testing.TB) string {
+	contentDir := t.TempDir()
+	for _, dir := range []string{"posts", "tags", ASSETS_DIR} {
+		require.NoError(t, os.MkdirAll(filepath.Join(contentDir, dir), 0750))
+	}
+
+	for name, title := range map[string]string{INDEX_FILE: "Home", BLOG_FILE: "Blog"} {
+		metadata, err := json.Marshal(Post{Title: title})
+		require.NoError(t, err)
+		require.NoError(t, writePost(filepath.Join(contentDir, name), metadata, []byte("Welcome\n")))
+	}
+
+	writeTestPost(t, contentDir, Post{Title: "Hello World", Date: "2024-01-02", Tags: []string{"golang"}}, "# Hello\n\nSome `code` and *emphasis*.\n")
+
+	tag, err := json.Marshal(Tag{Slug: "golang", Name: "Go"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, "tags", "golang.json"), tag, 0644))
+
+	return contentDir
+}
+
+/* Writes post under contentDir/posts, named after its title the way `post create` names it */
+func writeTestPost(t testing.TB, contentDir string, post Post, body string) {
+	metadata, err := json.Marshal(post)
+	require.NoError(t, err)
+	path := filepath.Join(contentDir, "posts", strings.ReplaceAll(post.Title, " ", "_")+".md")
+	require.NoError(t, writePost(path, metadata, []byte(body)))
+}
+
+func TestGenerateTo(t *testing.T) {
+	contentDir := writeTestContent(t)
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+
+	for _, name := range []string{"index.html", "blog.html", "blog/index.html", "404.html", "blog/Hello_World.html", "tagged/golang/golang.html", "assets/style.css", ".nojekyll"} {
+		require.Contains(t, fsys, name)
+	}
+	require.Contains(t, string(fsys["blog/Hello_World.html"]), "<h1")
+	/* The tag cloud shows the tag's name rather than its slug */
+	require.Contains(t, string(fsys["blog.html"]), `<a href="http://localhost:3000/tagged/golang/golang" title="See all posts by Go tag">#Go</a>`)
+}
+
+func TestGenerateToEscapesMetadata(t *testing.T) {
+	contentDir := writeTestContent(t)
+	metadata, err := json.Marshal(Post{Title: `Tom & "Jerry" </title><script>alert(1)</script>`, Date: "2024-01-03", Description: `Say "hi" <b>now</b>"><script>alert(2)</script>`})
+	require.NoError(t, err)
+	require.NoError(t, writePost(filepath.Join(contentDir, "posts", "Tom_And_Jerry.md"), metadata, []byte("Chase\n")))
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+
+	page := string(fsys["blog/Tom_And_Jerry.html"])
+	require.Contains(t, page, `<title>Tom &amp; &#34;Jerry&#34; &lt;/title&gt;&lt;script&gt;alert(1)&lt;/script&gt;</title>`)
+	require.Contains(t, page, `<meta name="description" content="Say &#34;hi&#34; &lt;b&gt;now&lt;/b&gt;&#34;&gt;&lt;script&gt;alert(2)&lt;/script&gt;">`)
+	require.NotContains(t, page, "<script>alert")
+}
+
+func TestGenerateToAnnouncement(t *testing.T) {
+	contentDir := writeTestContent(t)
+	fsys := memWriteFS{}
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, string(fsys["index.html"]), `class="announcement"`)
+
+	cfg := sampleCfg
+	cfg.Announcement = &Announcement{Text: "New talk", URL: "https://example.com/talk"}
+	fsys = memWriteFS{}
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	for _, name := range []string{"index.html", "blog/Hello_World.html", "tagged/golang/golang.html"} {
+		require.Contains(t, string(fsys[name]), `<a href="https://example.com/talk">New talk</a>`)
+	}
+}
+
+func TestGenerateToFeed(t *testing.T) {
+	contentDir := writeTestContent(t)
+	fsys := memWriteFS{}
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	for _, name := range []string{"feed.xml", "tagged/golang/feed.xml"} {
+		feed := string(fsys[name])
+		require.Contains(t, feed, "<title>Hello World</title>")
+		require.Contains(t, feed, "<description>Hello Some code and emphasis.</description>")
+	}
+
+	require.Contains(t, string(fsys["tagged/golang/golang.html"]), "/tagged/golang/feed.xml")
+	require.NotContains(t, string(fsys["index.html"]), "/tagged/golang/feed.xml")
+
+	cfg := sampleCfg
+	cfg.FeedFull = true
+	fsys = memWriteFS{}
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.Contains(t, string(fsys["feed.xml"]), "&lt;code&gt;code&lt;/code&gt;")
+}
+
+func TestGenerateToSitemap(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for _, post := range []Post{
+		{Title: "Hidden", Date: "2024-02-01", NoIndex: true},
+		{Title: "Unfinished", Date: "2024-02-02", Draft: true},
+	} {
+		writeTestPost(t, contentDir, post, "Secret\n")
+	}
+	tag, err := json.Marshal(Tag{Slug: "empty"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, "tags", "empty.json"), tag, 0644))
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{Drafts: true}))
+	sitemap := string(fsys["sitemap.xml"])
+	require.Contains(t, sitemap, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	for _, loc := range []string{"http://localhost:3000/", "http://localhost:3000/blog", "http://localhost:3000/tags", "http://localhost:3000/tagged/golang/golang", "http://localhost:3000/tagged/empty/empty"} {
+		require.Contains(t, sitemap, "<loc>"+loc+"</loc>")
+	}
+	require.Contains(t, sitemap, "<loc>http://localhost:3000/blog/Hello_World</loc>\n    <lastmod>2024-01-02</lastmod>")
+	require.NotContains(t, sitemap, "Hidden")
+	require.NotContains(t, sitemap, "Unfinished")
+	require.NotContains(t, sitemap, "404")
+}
+
+func TestRenderFeedOrder(t *testing.T) {
+	site := SiteData{Config: Config{Title: "Tom & Jerry", URL: "https://example.com", Description: "<b>Cartoons</b>"}}
+	posts := []Post{
+		{Title: "Undated", Permalink: "https://example.com/blog/Undated"},
+		{Title: "Older", Date: "Feb 21st, 2024", DateTime: time.Date(2024, 2, 21, 0, 0, 0, 0, time.UTC), Permalink: "https://example.com/blog/Older"},
+		{Title: "Newer <3", Date: "Mar 5th, 2024", DateTime: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), Description: "A & B", Permalink: "https://example.com/blog/Newer"},
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, renderFeed(fsys, posts, site, "", "feed.xml"))
+	feed := string(fsys["feed.xml"])
+	require.Contains(t, feed, "<title>Tom &amp; Jerry</title>")
+	require.Contains(t, feed, "<description>&lt;b&gt;Cartoons&lt;/b&gt;</description>")
+	require.Contains(t, feed, "<title>Newer &lt;3</title>")
+	require.Contains(t, feed, "<description>A &amp; B</description>")
+	require.Contains(t, feed, "<pubDate>Tue, 05 Mar 2024 00:00:00 +0000</pubDate>")
+	require.Contains(t, feed, "<pubDate>Wed, 21 Feb 2024 00:00:00 +0000</pubDate>")
+	newer, older, undated := strings.Index(feed, "/blog/Newer"), strings.Index(feed, "/blog/Older"), strings.Index(feed, "/blog/Undated")
+	require.True(t, newer < older && older < undated, feed)
+	require.Equal(t, 2, strings.Count(feed, "<pubDate>"))
+}
+
+func TestGenerateToDraftBanner(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Work In Progress", Date: "2024-01-03", Draft: true}, "Not yet\n")
+	cfg := sampleCfg
+	cfg.DraftSecret = "secret"
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{Drafts: true}))
+
+	var drafts int
+	for name, content := range fsys {
+		if strings.HasPrefix(name, "_drafts/") {
+			drafts++
+			require.Contains(t, string(content), `class="draft-banner"`)
+		} else {
+			require.NotContains(t, string(content), `class="draft-banner"`, name)
+		}
+	}
+	require.Equal(t, 1, drafts)
+}
+
+func TestGenerateToDraftsStayUnlisted(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Half Finished", Date: "2024-05-01", Draft: true, Tags: []string{"golang"}}, "Not yet\n")
+
+	/* Rendering drafts only adds their unlisted pages, nothing else refers to them */
+	for _, drafts := range []bool{false, true} {
+		fsys := memWriteFS{}
+		require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{Drafts: drafts}))
+		for name, content := range fsys {
+			if !strings.HasPrefix(name, "_drafts/") {
+				require.NotContains(t, string(content), "Half", name)
+			}
+		}
+		require.Contains(t, string(fsys["tags.html"]), "#Go</a> <small>(1)</small>")
+	}
+}
+
+func TestGenerateToMarkdownExtension(t *testing.T) {
+	contentDir := writeTestContent(t)
+	metadata, err := json.Marshal(Post{Title: "Imported Post", Date: "2024-01-03"})
+	require.NoError(t, err)
+	require.NoError(t, writePost(filepath.Join(contentDir, "posts", "Imported_Post.markdown"), metadata, []byte("From Jekyll\n")))
+	require.NoError(t, os.Rename(filepath.Join(contentDir, INDEX_FILE), filepath.Join(contentDir, "index.markdown")))
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	require.Contains(t, string(fsys["blog/Imported_Post.html"]), "From Jekyll")
+	require.Contains(t, string(fsys["blog.html"]), "Imported Post")
+	require.Contains(t, string(fsys["index.html"]), "Welcome")
+
+	/* Only the configured extensions are posts */
+	cfg := sampleCfg
+	cfg.PostExtensions = []string{".md"}
+	require.NoError(t, os.Rename(filepath.Join(contentDir, "index.markdown"), filepath.Join(contentDir, INDEX_FILE)))
+	fsys = memWriteFS{}
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, fsys, "blog/Imported_Post.html")
+}
+
+func TestGenerateToStrict(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Empty", Date: "2024-01-03"}, "")
+
+	require.NoError(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}))
+	require.Error(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{Strict: true}))
+}
+
+func TestGenerateToMalformedTag(t *testing.T) {
+	contentDir := writeTestContent(t)
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, "tags", "broken.json"), []byte(`{"slug": "broken",`), 0644))
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	t.Cleanup(func() { logger.SetOutput(os.Stderr) })
+
+	/* The tag is skipped with a warning and the rest of the site is generated */
+	site, err := loadSite(sampleCfg, contentDir)
+	require.NoError(t, err)
+	require.Len(t, site.TagErrors, 1)
+	require.ErrorContains(t, site.TagErrors[0], "broken.json")
+	require.Len(t, site.Config.Tags, 1)
+
+	fsys := memWriteFS{}
+	warned := warnings.Load()
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	require.Equal(t, warned+1, warnings.Load())
+	require.Contains(t, logs.String(), "warning: skipped tag:")
+	require.Contains(t, logs.String(), "broken.json")
+	require.Contains(t, fsys, "tagged/golang/golang.html")
+	require.NotContains(t, fsys, "tagged/broken/broken.html")
+
+	/* With --strict generating fails before any page is rendered */
+	fsys = memWriteFS{}
+	require.ErrorContains(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{Strict: true}), "broken.json")
+	require.NotContains(t, fsys, "index.html")
+	require.NotContains(t, fsys, "blog/Hello_World.html")
+}
+
+func TestGenerateToProgress(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Second", Date: "2024-01-03"}, "Two\n")
+
+	/* Output which isn't a terminal gets a line per post rather than a progress bar */
+	var out bytes.Buffer
+	require.NoError(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{Progress: &out}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], "posts rendered 1/2: "), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "posts rendered 2/2: "), lines[1])
+	require.Contains(t, out.String(), filepath.Join("blog", "Hello_World.html"))
+	require.Contains(t, out.String(), filepath.Join("blog", "Second.html"))
+	require.NotContains(t, out.String(), "\r")
+
+	/* --quiet leaves Progress unset, which reports nothing */
+	require.Nil(t, newProgress(nil, "posts rendered", 2))
+	require.NoError(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}))
+}
+
+func TestGenerateToConcurrentLinks(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for i := 0; i < 20; i++ {
+		writeTestPost(t, contentDir, Post{Title: fmt.Sprintf("Post %d", i), Date: "2024-01-03"}, fmt.Sprintf("See [the next one](post:Post_%d) and [the first one](post:Post_0)\n", (i+1)%20))
+	}
+	fsys := memWriteFS{}
+
+	/* Run with -race: posts link to one another while they are rendered concurrently */
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{Jobs: 8}))
+	require.Contains(t, string(fsys["blog/Post_19.html"]), `<a href="http://localhost:3000/blog/Post_0">the next one</a>`)
+	require.Contains(t, string(fsys["blog/Post_3.html"]), `<a href="http://localhost:3000/blog/Post_4">the next one</a>`)
+}
+
+func TestGenerateToWithoutEmbeddedAssets(t *testing.T) {
+	contentDir := writeTestContent(t)
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, ASSETS_DIR, "theme.css"), []byte("body {}"), 0644))
+	cfg := sampleCfg
+	embedded := false
+	cfg.EmbeddedAssets = &embedded
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.Contains(t, fsys, "assets/theme.css")
+	require.NotContains(t, fsys, "assets/style.css")
+	require.NotContains(t, fsys, "assets/favicon.ico")
+}
+
+func TestGenerateToWithoutNoJekyll(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	noJekyll := false
+	cfg.NoJekyll = &noJekyll
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, fsys, ".nojekyll")
+}
+
+func TestGenerateToExtraFiles(t *testing.T) {
+	contentDir := writeTestContent(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, "hosting"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, "hosting", "_headers"), []byte("/*\n  X-Frame-Options: DENY\n"), 0644))
+	cfg := sampleCfg
+	cfg.ExtraFiles = []ExtraFile{
+		{Path: "_redirects", Content: "/old /blog/Hello_World 301"},
+		{Path: "_headers", Source: "hosting/_headers"},
+		{Path: ".well-known/security.txt", Content: "Contact: mailto:me@example.com"},
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.Equal(t, "/old /blog/Hello_World 301", string(fsys["_redirects"]))
+	require.Equal(t, "/*\n  X-Frame-Options: DENY\n", string(fsys["_headers"]))
+	require.Equal(t, "Contact: mailto:me@example.com", string(fsys[filepath.Join(".well-known", "security.txt")]))
+
+	for _, file := range []ExtraFile{
+		{Path: "../outside", Content: "x"},
+		{Path: "/etc/outside", Content: "x"},
+		{Path: "both", Content: "x", Source: "hosting/_headers"},
+		{Path: "neither"},
+		{Path: "missing", Source: "hosting/missing"},
+	} {
+		cfg.ExtraFiles = []ExtraFile{file}
+		require.Error(t, generateTo(memWriteFS{}, cfg, contentDir, GenerateOptions{}), file.Path)
+	}
+}
+
+func TestGenerateToPostsSortedByDate(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for _, post := range []Post{
+		{Title: "Aardvarks", Date: "2022-07-01"},
+		{Title: "Bees"},
+		{Title: "Cats", Date: "Mar 3rd, 2025"},
+	} {
+		writeTestPost(t, contentDir, post, "Animals\n")
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	blog := string(fsys["blog.html"])
+	cats, hello, aardvarks, bees := strings.Index(blog, "/blog/Cats"), strings.Index(blog, "/blog/Hello_World"), strings.Index(blog, "/blog/Aardvarks"), strings.Index(blog, "/blog/Bees")
+	require.True(t, cats < hello && hello < aardvarks && aardvarks < bees, blog)
+}
+
+func TestGenerateToPinnedPosts(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for _, post := range []Post{
+		{Title: "Alpha Pin", Date: "2023-01-01", Pinned: true},
+		{Title: "Zeta Pin", Date: "2024-06-01", Pinned: true},
+		{Title: "Summed Pin", Date: "2022-01-01", Pinned: true, SummaryText: "Pinned with a summary"},
+	} {
+		writeTestPost(t, contentDir, post, "Read me first\n")
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	blog := string(fsys["blog.html"])
+	/* Pinned posts come first, newest first - the opposite of their filename order */
+	zeta, alpha, summed, hello := strings.Index(blog, "Zeta_Pin"), strings.Index(blog, "Alpha_Pin"), strings.Index(blog, "Summed_Pin"), strings.Index(blog, "Hello_World")
+	require.True(t, zeta < alpha && alpha < summed && summed < hello, blog)
+	/* Every post has some text, so all of them are listed with a summary */
+	require.Equal(t, 3, strings.Count(blog, `class="has-summary pinned"`))
+	require.NotContains(t, blog, `class="pinned"`)
+	require.NotContains(t, blog, `class=" `)
+}
+
+func TestGenerateToSummary(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for _, post := range []Post{
+		{Title: "Described", Date: "2024-02-01", Description: "For search engines", SummaryText: "For *readers*"},
+		{Title: "Undescribed", Date: "2024-03-01", SummaryText: "Only a summary"},
+	} {
+		writeTestPost(t, contentDir, post, "The body\n\n<!--more-->\n\nThe rest\n")
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	blog := string(fsys["blog.html"])
+	require.Contains(t, blog, "For <em>readers</em>")
+	require.Contains(t, blog, "Only a summary")
+	require.NotContains(t, blog, "The body")
+	require.Contains(t, string(fsys["blog/Described.html"]), `<meta name="description" content="For search engines">`)
+	require.Contains(t, string(fsys["blog/Undescribed.html"]), `<meta name="description" content="The body The rest">`)
+
+	/* Without a summary or the separator, the listing falls back to the excerpt and feeds to the description */
+	writeTestPost(t, contentDir, Post{Title: "Plain", Date: "2024-04-01", Description: "Searchable"}, "Fish & chips\n")
+	fsys = memWriteFS{}
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	require.Contains(t, string(fsys["blog.html"]), "<p>Fish &amp; chips</p>")
+	require.Contains(t, string(fsys["feed.xml"]), "<description>Searchable</description>")
+}
+
+func TestGenerateToPostsByYear(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Last Year", Date: "2023-05-01"}, "Older\n")
+	cfg := sampleCfg
+	cfg.GroupByYear = true
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	blog := string(fsys["blog.html"])
+	y2024, hello, y2023, last := strings.Index(blog, `<h2 class="year">2024</h2>`), strings.Index(blog, "Hello_World"), strings.Index(blog, `<h2 class="year">2023</h2>`), strings.Index(blog, "Last_Year")
+	require.True(t, y2024 != -1 && y2024 < hello && hello < y2023 && y2023 < last, blog)
+
+	site := SiteData{Config: cfg}
+	site.Posts = []Post{
+		{Title: "a", DateTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Title: "b"},
+		{Title: "c", DateTime: time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{Title: "d", DateTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	require.Equal(t, []PostGroup{
+		{Year: 2024, Posts: []Post{site.Posts[0], site.Posts[3]}},
+		{Year: 2022, Posts: []Post{site.Posts[2]}},
+		{Year: 0, Posts: []Post{site.Posts[1]}},
+	}, site.PostGroups())
+	site.GroupByYear = false
+	require.Equal(t, []PostGroup{{Posts: site.Posts}}, site.PostGroups())
+}
+
+func TestGenerateToAssetsPath(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	cfg.Paths.Assets = "/static/"
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.Contains(t, fsys, "static/style.css")
+	require.NotContains(t, fsys, "assets/style.css")
+	require.Contains(t, string(fsys["index.html"]), `href="http://localhost:3000/static/style.css"`)
+
+	cfg.Paths.Assets = "/../outside"
+	require.Error(t, generateTo(memWriteFS{}, cfg, contentDir, GenerateOptions{}))
+}
+
+func TestGenerateToCover(t *testing.T) {
+	contentDir := writeTestContent(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, ASSETS_DIR, "images"), 0750))
+	f, err := os.Create(filepath.Join(contentDir, ASSETS_DIR, "images", "cover.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+	require.NoError(t, f.Close())
+	writeTestPost(t, contentDir, Post{Title: "Covered", Date: "2024-01-03", Cover: "images/cover.png"}, "Look\n")
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	post := string(fsys["blog/Covered.html"])
+	require.Contains(t, post, `<meta property="og:image" content="http://localhost:3000/assets/images/cover.png">`)
+	require.Contains(t, post, `<meta property="og:image:width" content="40">`)
+	require.Contains(t, post, `src="http://localhost:3000/assets/images/cover.png" width="40" height="20"`)
+	require.Contains(t, string(fsys["blog.html"]), `width="40" height="20"`)
+
+	/* A missing cover image fails generate */
+	writeTestPost(t, contentDir, Post{Title: "Broken", Date: "2024-01-04", Cover: "images/missing.png"}, "Oops\n")
+	require.Error(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}))
+}
+
+func TestGenerateToNotFoundSuggestions(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, string(fsys["404.html"]), "not-found-suggestions")
+
+	cfg.NotFoundHints = true
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.Contains(t, string(fsys["404.html"]), `[{"Title":"Hello World","URL":"http://localhost:3000/blog/Hello_World"}]`)
+	require.NotContains(t, string(fsys["index.html"]), "not-found-suggestions")
+}
+
+func TestGenerateToSpecialLinks(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	cfg.SpecialLinks = []Link{
+		{URL: "https://github.com/me", DisplayText: "Github", NewTab: true},
+		{URL: "https://mastodon.social/@me", DisplayText: "Mastodon", Rel: "me"},
+		{URL: "https://example.com", DisplayText: "Plain"},
+	}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	index := string(fsys["index.html"])
+	require.Contains(t, index, `<a href="https://github.com/me" target="_blank" rel="noopener noreferrer">[Github]</a>`)
+	require.Contains(t, index, `<a href="https://mastodon.social/@me" rel="me">[Mastodon]</a>`)
+	require.Contains(t, index, `<a href="https://example.com">[Plain]</a>`)
+}
+
+func TestGenerateToEditURL(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, string(fsys["blog/Hello_World.html"]), "Edit this page")
+
+	cfg.EditURLFormat = "https://github.com/me/site/edit/main/{path}"
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	want := fmt.Sprintf(`<a href="https://github.com/me/site/edit/main/%s" class="edit-link">Edit this page</a>`, filepath.ToSlash(filepath.Join(contentDir, "posts", "Hello_World.md")))
+	require.Contains(t, string(fsys["blog/Hello_World.html"]), want)
+}
+
+func TestRenderMarkdownNewTabLinks(t *testing.T) {
+	cfg := sampleCfg
+	cfg.ExternalNewTab = true
+	sameTab := false
+
+	for newTab, want := range map[*bool]bool{nil: true, &sameTab: false} {
+		post := Post{Markdown: []byte("[a site](https://example.com)"), NewTabLinks: newTab}
+		require.NoError(t, renderMarkdown(&post, cfg))
+		require.Equal(t, want, strings.Contains(string(post.HTML), `target="_blank"`))
+	}
+}
+
+func TestGenerateToTagsPage(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	for _, name := range []string{"tags.html", "tags/index.html"} {
+		require.Contains(t, string(fsys[name]), `<a href="http://localhost:3000/tagged/golang/golang">#Go</a> <small>(1)</small>`, name)
+		require.Contains(t, string(fsys[name]), `<body class="tags">`, name)
+	}
+
+	tagsPage := false
+	cfg.TagsPage = &tagsPage
+	fsys = memWriteFS{}
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	require.NotContains(t, fsys, "tags.html")
+}
+
+func TestGenerateToSections(t *testing.T) {
+	contentDir := writeTestContent(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, "projects"), 0750))
+	metadata, err := json.Marshal(Post{Title: "My Project", Date: "2024-02-01"})
+	require.NoError(t, err)
+	require.NoError(t, writePost(filepath.Join(contentDir, "projects", "My_Project.md"), metadata, []byte("Built with *Go*\n")))
+	metadata, err = json.Marshal(Post{Title: "Own Layout", Layout: "page"})
+	require.NoError(t, err)
+	require.NoError(t, writePost(filepath.Join(contentDir, "projects", "Own_Layout.md"), metadata, []byte("Laid out as a page\n")))
+	cfg := sampleCfg
+	cfg.Sections = []Section{{Dir: "projects", Layout: "project", Path: "/projects", Title: "Projects"}}
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	for _, name := range []string{"projects.html", "projects/index.html"} {
+		require.Contains(t, string(fsys[name]), "<h1>Projects</h1>", name)
+		require.Contains(t, string(fsys[name]), `<a href="http://localhost:3000/projects/My_Project">My Project</a>`, name)
+	}
+	page := string(fsys["projects/My_Project.html"])
+	require.Contains(t, page, "My Project")
+	require.Contains(t, page, "Built with <em>Go</em>")
+	require.NotContains(t, page, "<article>")
+	/* A layout in the frontmatter of a page wins over the layout of its section */
+	require.Contains(t, string(fsys["projects/Own_Layout.html"]), "<article>")
+	/* Pages of a section aren't posts */
+	require.NotContains(t, fsys, "blog/My_Project.html")
+	require.NotContains(t, string(fsys["blog.html"]), "My_Project")
+}
+
+func TestCheckSection(t *testing.T) {
+	require.NoError(t, checkSection(Section{Dir: "projects", Path: "/projects"}))
+	require.NoError(t, checkSection(Section{Dir: "projects", Layout: "project", Path: "/work/projects"}))
+
+	for _, section := range []Section{
+		{Dir: "posts", Path: "/projects"},
+		{Dir: "tags", Path: "/projects"},
+		{Dir: "projects/old", Path: "/projects"},
+		{Dir: "projects", Path: "/blog"},
+		{Dir: "projects", Path: "/tags"},
+		{Dir: "projects", Path: "/projects/"},
+		{Dir: "projects", Path: "projects"},
+		{Dir: "projects", Path: "/projects", Layout: "missing"},
+	} {
+		require.Error(t, checkSection(section), section)
+	}
+}
+
+func TestGenerateToAliases(t *testing.T) {
+	contentDir, siteDir := writeTestContent(t), t.TempDir()
+	writeTestPost(t, contentDir, Post{Title: "Renamed", Date: "2024-03-01", Aliases: []string{"/blog/old_name", "2023/01/old/"}}, "Moved here\n")
+
+	require.NoError(t, generateTo(dirWriteFS(siteDir), sampleCfg, contentDir, GenerateOptions{}))
+	page, err := os.ReadFile(filepath.Join(siteDir, "blog", "old_name", "index.html"))
+	require.NoError(t, err)
+	require.Contains(t, string(page), `<meta http-equiv="refresh" content="0; url=http://localhost:3000/blog/Renamed">`)
+	require.Equal(t, map[string]string{"/blog/old_name": "/blog/Renamed", "/2023/01/old": "/blog/Renamed"}, readAliases(siteDir))
+
+	/* serve redirects aliases instead of serving their refresh page */
+	for _, path := range []string{"/blog/old_name", "/2023/01/old/"} {
+		rec := httptest.NewRecorder()
+		siteHandler(ServeOptions{Dir: siteDir}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusMovedPermanently, rec.Code, path)
+		require.Equal(t, "/blog/Renamed", rec.Header().Get("Location"), path)
+	}
+
+	writeTestPost(t, contentDir, Post{Title: "Escape", Aliases: []string{"../outside"}}, "Nope\n")
+	require.ErrorContains(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}), "must be a path within the site")
+
+	/* Aliases can't replace generated pages or folders */
+	for _, alias := range []string{"/blog", "/tags/", "/tagged/golang", "/assets/style.css", "/blog/Hello_World", "/feed.xml"} {
+		writeTestPost(t, contentDir, Post{Title: "Escape", Aliases: []string{alias}}, "Nope\n")
+		require.ErrorContains(t, generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}), "would replace a generated page", alias)
+	}
+}
+
+func TestGenerateToBodyClass(t *testing.T) {
+	contentDir := writeTestContent(t)
+	writeTestPost(t, contentDir, Post{Title: "Wide Post", Date: "2024-01-03", BodyClass: "wide"}, "Lots of tables\n")
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, sampleCfg, contentDir, GenerateOptions{}))
+	for name, class := range map[string]string{
+		"index.html":                "home",
+		"blog.html":                 "blog",
+		"blog/Hello_World.html":     "post",
+		"blog/Wide_Post.html":       "post wide",
+		"tagged/golang/golang.html": "tag",
+		"404.html":                  "not-found",
+	} {
+		require.Contains(t, string(fsys[name]), fmt.Sprintf(`<body class="%s">`, class), name)
+	}
+}
+
+func TestGenerateToAnalyticsOnlyInProduction(t *testing.T) {
+	contentDir := writeTestContent(t)
+	cfg := sampleCfg
+	cfg.Analytics.TrackingID = "G-TEST"
+
+	for env, want := range map[string]bool{"": true, ENV_PRODUCTION: true, ENV_DEVELOPMENT: false, "staging": false} {
+		fsys := memWriteFS{}
+		require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{Env: env}))
+		require.Equal(t, want, strings.Contains(string(fsys["index.html"]), "googletagmanager.com/gtag/js?id=G-TEST"), env)
+	}
+}
+
+func TestGenerateToTagPagination(t *testing.T) {
+	contentDir := writeTestContent(t)
+	for _, title := range []string{"Second Post", "Third Post"} {
+		writeTestPost(t, contentDir, Post{Title: title, Date: "2024-01-03", Tags: []string{"golang"}}, "More Go\n")
+	}
+	cfg := sampleCfg
+	cfg.PostsPerPage = 2
+	fsys := memWriteFS{}
+
+	require.NoError(t, generateTo(fsys, cfg, contentDir, GenerateOptions{}))
+	first, second := string(fsys["tagged/golang/golang.html"]), string(fsys["tagged/golang/page/2.html"])
+	require.Contains(t, first, "Page 1 of 2")
+	require.Contains(t, first, `href="http://localhost:3000/tagged/golang/page/2" rel="next"`)
+	require.Contains(t, second, "Page 2 of 2")
+	require.Contains(t, second, `href="http://localhost:3000/tagged/golang/golang" rel="prev"`)
+	require.Equal(t, 3, strings.Count(first, `<li>`)+strings.Count(second, `<li>`))
+}
+
+func BenchmarkGenerateTo(b *testing.B) {
+	contentDir := writeTestContent(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := generateTo(memWriteFS{}, sampleCfg, contentDir, GenerateOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIsExternalLink(t *testing.T) {
+	siteURL := "https://chettriyuvraj.github.io"
+	for dest, want := range map[string]bool{
+		"https://github.com/chettriyuvraj":             true,
+		"http://example.com/page":                      true,
+		"https://chettriyuvraj.github.io/blog/my_post": false,
+		"https://CHETTRIYUVRAJ.github.io":              false,
+		"/blog/my_post":                                false,
+		"#conclusion":                                  false,
+		"mailto:me@example.com":                        false,
+	} {
+		require.Equal(t, want, isExternalLink(dest, siteURL), dest)
+	}
+}